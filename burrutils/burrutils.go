@@ -172,6 +172,73 @@ func BitmapSize(bitmap int) (count int) {
 	return count
 }
 
+// NumRotations is the number of proper rotations, NumTransformations adds their mirror images
+const (
+	NumRotations       = 24
+	NumTransformations = 48
+)
+
+/*
+transformations holds the 24 rotations, followed by the 24 rotations applied after a mirror in the x axis.
+doubleTransformations[t1*48 + t2] is the transformation t1 followed by t2, like doubleRotations.
+Both are calculated in init from the rotations.
+*/
+var transformations [NumTransformations]rotation_t
+var doubleTransformations [NumTransformations * NumTransformations]Id_t
+
+func init() {
+	for t := 0; t < NumRotations; t++ {
+		transformations[t] = rotations[t]
+		m := rotations[t]
+		// mirror x first: negate the first column
+		m[0], m[3], m[6] = -m[0], -m[3], -m[6]
+		transformations[NumRotations+t] = m
+	}
+	for t1 := 0; t1 < NumTransformations; t1++ {
+		for t2 := 0; t2 < NumTransformations; t2++ {
+			a, b := transformations[t1], transformations[t2]
+			var m rotation_t
+			for r := 0; r < 3; r++ {
+				for c := 0; c < 3; c++ {
+					m[r*3+c] = b[r*3]*a[c] + b[r*3+1]*a[3+c] + b[r*3+2]*a[6+c]
+				}
+			}
+			for t := 0; t < NumTransformations; t++ {
+				if transformations[t] == m {
+					doubleTransformations[t1*NumTransformations+t2] = Id_t(t)
+					break
+				}
+			}
+		}
+	}
+}
+
+/*
+IsMirror returns true if the transformation turns a shape into its mirror image
+*/
+func IsMirror(t Id_t) bool {
+	return t >= NumRotations
+}
+
+/*
+DoubleTransform gives the equivalent transformation of 2 successive transformations (t1 followed by t2).
+For 2 rotations it is the same as DoubleRotate.
+*/
+func DoubleTransform(t1, t2 Id_t) Id_t {
+	return doubleTransformations[NumTransformations*t1+t2]
+}
+
+/*
+Transform applies one of the 48 transformations, rotations or their mirror images
+*/
+func Transform(x, y, z Distance_t, t Id_t) (rx, ry, rz Distance_t) {
+	m := transformations[t]
+	rx = x*m[0] + y*m[1] + z*m[2]
+	ry = x*m[3] + y*m[4] + z*m[5]
+	rz = x*m[6] + y*m[7] + z*m[8]
+	return
+}
+
 /*
 Rotate and Translate a Worldmap
 */
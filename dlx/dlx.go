@@ -2,10 +2,37 @@
 Port of the dlx implementation of Tim Beyer (https://github.com/TimBeyer/node-dlx)
 Tim created a dlx implementation that does NOT use recursion, but uses a statemachine.
 Go is not very good at deep recursive calls, and hopefully this implementation will be more performant.
+
+A Matrix holds an exact cover problem: named primary columns that every solution covers exactly once,
+secondary columns that a solution covers at most once, and rows that cover some of the columns.
+A row can give a color to the secondary columns it covers, like Knuth's Algorithm C: rows that give the same color
+to a secondary column can be part of the same solution, an uncolored secondary column still allows only 1 row.
+A primary column can have a multiplicity instead, like Knuth's Algorithm M: every solution covers it at least min
+and at most max times. Rows that cover such a column are chosen in the order they were added, so a solution
+is found once and not once for every order of its rows.
+Every row carries a payload of type T. The statemachine can stop after every solution and continue later,
+so the solutions are available through an Iterator as well as through Search with a visitor.
+Parallel splits the search over several goroutines, and keeps the order of the solutions.
 */
 
 package dlx
 
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDuplicateColumn = errors.New("dlx: duplicate column")
+	ErrUnknownColumn   = errors.New("dlx: unknown column")
+	ErrEmptyRow        = errors.New("dlx: row covers no primary columns")
+	ErrColor           = errors.New("dlx: only secondary columns can have a color")
+	ErrBounds          = errors.New("dlx: invalid column bounds")
+	ErrBudgetExceeded  = errors.New("dlx: budget exceeded")
+)
+
 type searchState int
 
 const (
@@ -16,284 +43,837 @@ const (
 	doneState    searchState = 4
 )
 
-type Row_t struct {
-	coveredColumns []int
-	data           any
-}
+// checkInterval is the number of steps between two checks of the context
+const checkInterval = 1024
+
+// maxMemo is the largest number of residual problems Count keeps
+const maxMemo = 1 << 22
 
 type nodeindex_t int
 type columnindex_t int
 
-type Searchconfig_t struct {
-	NumPrimary   int
-	NumSecondary int
-	NumSolutions int
-	rows         []Row_t
+/*
+Row is a row of the matrix: the columns it covers and its payload
+*/
+type Row[T any] struct {
+	Index   int   // the number of the row, in the order of AddRow
+	Columns []int // the columns it covers
+	Colors  []int // the color of every column, 0 means no color. nil when the row has no colors
+	Data    T
 }
 
-type result_t struct {
-	index int
-	data  any
+/*
+Matrix is an exact cover problem with rows that carry a payload of type T.
+Create it with NewMatrix, add the columns and then the rows.
+*/
+type Matrix[T any] struct {
+	names     []string
+	secondary []bool
+	lower     []int // the number of times a solution has to cover every column
+	upper     []int // the number of times a solution can cover every column
+	columns   map[string]int
+	primary   int
+	rows      []Row[T]
+	colors    map[string]int
 }
 
-func (r *result_t) GetData() any {
-	return r.data
+func NewMatrix[T any]() *Matrix[T] {
+	return &Matrix[T]{columns: make(map[string]int), colors: make(map[string]int)}
 }
 
-func (sc *Searchconfig_t) AddRow(columns []int, data any) {
-	if sc.rows == nil {
-		sc.rows = make([]Row_t, 0)
+/*
+AddPrimary adds primary columns, that every solution covers exactly once.
+It returns the index of the first one.
+*/
+func (m *Matrix[T]) AddPrimary(names ...string) (int, error) {
+	return m.addColumns(names, false, 1, 1)
+}
+
+/*
+AddBounded adds primary columns with a multiplicity, that every solution covers at least min and at most max times.
+It returns the index of the first one.
+*/
+func (m *Matrix[T]) AddBounded(min, max int, names ...string) (int, error) {
+	if min < 0 || max < 1 || min > max {
+		return -1, fmt.Errorf("%w [%d,%d]", ErrBounds, min, max)
 	}
-	sc.rows = append(sc.rows, Row_t{columns, data})
+	return m.addColumns(names, false, min, max)
 }
 
-func (config *Searchconfig_t) Search() [][]result_t {
-	numSolutions := config.NumSolutions
-	numPrimary, numSecondary, rows := config.NumPrimary, config.NumSecondary, config.rows
-	root := columnindex_t(0)
+/*
+AddSecondary adds secondary columns, that a solution covers at most once.
+It returns the index of the first one.
+*/
+func (m *Matrix[T]) AddSecondary(names ...string) (int, error) {
+	return m.addColumns(names, true, 0, 1)
+}
 
-	numNodes := 0
-	for i := range config.rows {
-		numNodes += len(rows[i].coveredColumns)
+func (m *Matrix[T]) addColumns(names []string, secondary bool, lower, upper int) (int, error) {
+	for i, name := range names {
+		if _, ok := m.columns[name]; ok {
+			return -1, fmt.Errorf("%w %q", ErrDuplicateColumn, name)
+		}
+		for _, other := range names[:i] {
+			if other == name {
+				return -1, fmt.Errorf("%w %q", ErrDuplicateColumn, name)
+			}
+		}
+	}
+	first := len(m.names)
+	for _, name := range names {
+		m.columns[name] = len(m.names)
+		m.names = append(m.names, name)
+		m.secondary = append(m.secondary, secondary)
+		m.lower = append(m.lower, lower)
+		m.upper = append(m.upper, upper)
 	}
+	if !secondary {
+		m.primary += len(names)
+	}
+	return first, nil
+}
 
-	solutions := [][]result_t{{}}
-	nleft := make([]nodeindex_t, numNodes+numPrimary+numSecondary+1)
-	nright := make([]nodeindex_t, numNodes+numPrimary+numSecondary+1)
-	nup := make([]nodeindex_t, numNodes+numPrimary+numSecondary+1)
-	ndown := make([]nodeindex_t, numNodes+numPrimary+numSecondary+1)
-	ncol := make([]columnindex_t, numNodes+numPrimary+numSecondary+1)
-	nindex := make([]int, numNodes+numPrimary+numSecondary+1)
-	ndata := make([]any, numNodes+numPrimary+numSecondary+1)
-	chead := make([]nodeindex_t, numPrimary+numSecondary+1)
-	clen := make([]nodeindex_t, numPrimary+numSecondary+1)
-	cprev := make([]columnindex_t, numPrimary+numSecondary+1)
-	cnext := make([]columnindex_t, numPrimary+numSecondary+1)
+/*
+Column returns the index of the column with the given name
+*/
+func (m *Matrix[T]) Column(name string) (int, bool) {
+	c, ok := m.columns[name]
+	return c, ok
+}
 
-	currentSearchState := forwardState
-	running := true
-	level := 0
-	choice := make([]nodeindex_t, 100)
-	var bestCol columnindex_t
-	var currentNode nodeindex_t
+func (m *Matrix[T]) ColumnName(c int) string {
+	return m.names[c]
+}
 
-	var readColumnNames = func() {
-		// Skip root node
-		curColIndex := columnindex_t(1)
-		curNodeIndex := nodeindex_t(0)
+func (m *Matrix[T]) IsSecondary(c int) bool {
+	return m.secondary[c]
+}
 
-		for i := 0; i < numPrimary; i++ {
-			head := curNodeIndex
-			nup[head] = head
-			ndown[head] = head
+/*
+Bounds returns the number of times a solution covers column c: at least min and at most max
+*/
+func (m *Matrix[T]) Bounds(c int) (min, max int) {
+	return m.lower[c], m.upper[c]
+}
 
-			column := curColIndex
-			chead[column] = head
-			clen[column] = 0
+func (m *Matrix[T]) NumPrimary() int {
+	return m.primary
+}
 
-			cprev[column] = column - 1
-			cnext[column-1] = column
+func (m *Matrix[T]) NumSecondary() int {
+	return len(m.names) - m.primary
+}
 
-			//			colArray[curColIndex] = column
-			curColIndex += 1
-			curNodeIndex += 1
-		}
+func (m *Matrix[T]) NumRows() int {
+	return len(m.rows)
+}
 
-		lastCol := curColIndex - 1
-		// Link the last primary constraint to wrap back into the root
-		cnext[lastCol] = root
-		cprev[root] = lastCol
+/*
+Row returns the row with index r
+*/
+func (m *Matrix[T]) Row(r int) *Row[T] {
+	return &m.rows[r]
+}
 
-		for i := 0; i < numSecondary; i++ {
-			head := curNodeIndex
-			nup[head] = head
-			ndown[head] = head
+/*
+Color returns the number of a named color, the first name gets 1
+*/
+func (m *Matrix[T]) Color(name string) int {
+	c, ok := m.colors[name]
+	if !ok {
+		c = len(m.colors) + 1
+		m.colors[name] = c
+	}
+	return c
+}
 
-			column := curColIndex
-			chead[column] = head
-			clen[column] = 0
-			cprev[column] = column
-			cnext[column] = column
+/*
+AddRow adds a row that covers the columns with the given indices, and returns the index of the row
+*/
+func (m *Matrix[T]) AddRow(data T, columns ...int) (int, error) {
+	return m.AddColoredRow(data, columns, nil)
+}
 
-			//			colArray[curColIndex] = column
-			curColIndex += 1
-			curNodeIndex += 1
+/*
+AddColoredRow adds a row that covers the columns with the given indices, and gives them the colors.
+Only secondary columns can have a color other than 0, colors can be nil when there are none.
+*/
+func (m *Matrix[T]) AddColoredRow(data T, columns []int, colors []int) (int, error) {
+	if colors != nil && len(colors) != len(columns) {
+		return -1, fmt.Errorf("dlx: %d colors for %d columns", len(colors), len(columns))
+	}
+	// a row without primary columns can never be chosen
+	primary := false
+	for i, c := range columns {
+		if c < 0 || c >= len(m.names) {
+			return -1, fmt.Errorf("%w %d", ErrUnknownColumn, c)
+		}
+		primary = primary || !m.secondary[c]
+		for _, other := range columns[:i] {
+			if other == c {
+				return -1, fmt.Errorf("%w %q in a row", ErrDuplicateColumn, m.names[c])
+			}
+		}
+		if colors != nil && colors[i] != 0 && !m.secondary[c] {
+			return -1, fmt.Errorf("%w, not %q", ErrColor, m.names[c])
 		}
 	}
+	if !primary {
+		return -1, ErrEmptyRow
+	}
+	row := Row[T]{Index: len(m.rows), Columns: append([]int(nil), columns...), Data: data}
+	for _, color := range colors {
+		if color != 0 {
+			row.Colors = append([]int(nil), colors...)
+			break
+		}
+	}
+	m.rows = append(m.rows, row)
+	return len(m.rows) - 1, nil
+}
 
-	var readRows = func() {
-		curNodeIndex := nodeindex_t(numPrimary + numSecondary + 1)
-
-		for i := 0; i < len(rows); i++ {
-			row := rows[i]
-			var rowStart nodeindex_t
+/*
+AddNamedRow adds a row that covers the columns with the given names, and returns the index of the row
+*/
+func (m *Matrix[T]) AddNamedRow(data T, names ...string) (int, error) {
+	columns := make([]int, len(names))
+	for i, name := range names {
+		c, ok := m.columns[name]
+		if !ok {
+			return -1, fmt.Errorf("%w %q", ErrUnknownColumn, name)
+		}
+		columns[i] = c
+	}
+	return m.AddRow(data, columns...)
+}
 
-			for _, columnIndex := range row.coveredColumns {
-				node := curNodeIndex
-				nleft[node] = node
-				nright[node] = node
-				ndown[node] = node
-				nup[node] = node
-				nindex[node] = i
-				ndata[node] = row.data
+/*
+AddNamedColoredRow adds a row that covers the columns with the given names, and gives them the named colors.
+An empty name is no color.
+*/
+func (m *Matrix[T]) AddNamedColoredRow(data T, names []string, colors []string) (int, error) {
+	if len(colors) != len(names) {
+		return -1, fmt.Errorf("dlx: %d colors for %d columns", len(colors), len(names))
+	}
+	columns := make([]int, len(names))
+	numbers := make([]int, len(names))
+	for i, name := range names {
+		c, ok := m.columns[name]
+		if !ok {
+			return -1, fmt.Errorf("%w %q", ErrUnknownColumn, name)
+		}
+		columns[i] = c
+		if colors[i] != "" {
+			numbers[i] = m.Color(colors[i])
+		}
+	}
+	return m.AddColoredRow(data, columns, numbers)
+}
 
-				//				nodeArray[curNodeIndex] = node
+/*
+Search calls visit for every solution, until visit returns false or ctx is cancelled.
+The solution lists the chosen rows, and is only valid during the call.
+It returns ctx.Err() when the search was cancelled.
+*/
+func (m *Matrix[T]) Search(ctx context.Context, visit func(solution []*Row[T]) bool) error {
+	it := m.Iterator(ctx)
+	for it.Next() {
+		if !visit(it.Solution()) {
+			break
+		}
+	}
+	return it.Err()
+}
 
-				if rowStart == 0 {
-					rowStart = node
-				} else {
-					nleft[node] = node - 1
-					nright[node-1] = node
-				}
+/*
+Iterator walks through the solutions of a Matrix, one for every call to Next.
+Rows that are added to the matrix after the Iterator was created are not part of the search.
+Set MaxSteps and Progress before the first call to Next or Count.
+*/
+type Iterator[T any] struct {
+	MaxSteps int // stop with ErrBudgetExceeded after this many steps forward, 0 means no limit
+	// Progress is called every 1024 steps when it is set, with the steps taken, the current level and the solutions found
+	Progress func(steps, level, solutions int)
+
+	ctx  context.Context
+	err  error
+	rows []Row[T]
+
+	nleft  []nodeindex_t
+	nright []nodeindex_t
+	nup    []nodeindex_t
+	ndown  []nodeindex_t
+	ncol   []columnindex_t
+	nrow   []int
+	ncolor []int // 0 is no color, -1 marks a node that has the color its column was purified with
+	chead  []nodeindex_t
+	clen   []nodeindex_t
+	cprev  []columnindex_t
+	cnext  []columnindex_t
+	cbound []int // the number of times a column can still be covered, BOUND of Algorithm M
+	cslack []int // the maximum minus the minimum of a column, SLACK of Algorithm M
+	cpure  []int // the color a column was purified with
+
+	bounded []columnindex_t // the primary columns with a multiplicity other than [1,1]
+	colored bool            // true if a row has a color
+
+	state       searchState
+	level       int
+	steps       int
+	choice      []nodeindex_t // the row chosen at every level, or the header when the level covers its column no more
+	first       []nodeindex_t // the first row of the column of every level that tweaks its column
+	branch      []int         // the number of the choice of every level, in the order they are tried
+	bestCol     columnindex_t
+	currentNode nodeindex_t
+	solution    []*Row[T]
+
+	// Count counts the solutions instead of returning them, with memoize it keeps the number of solutions of
+	// the residual problems in memo. Level l started with residual problem memoKey[l], after memoStart[l] solutions.
+	counting  bool
+	count     int // the number of solutions found
+	memo      map[string]int
+	memoKey   []string
+	memoStart []int
+	inactive  []uint64 // the columns that are covered or taken out of the list of the root
+
+	// a worker of Parallel searches a subtree: level l < len(lo) only tries the choices lo[l] up to hi[l],
+	// hi[l] < 0 means up to the last one. With split the search stops at level depth and passes the choices
+	// that lead there to split. check is called every checkInterval steps.
+	lo, hi []int
+	depth  int
+	split  func(branch []int)
+	check  func() error
+}
 
-				//				col := colArray[columnIndex+1]
-				ncol[node] = columnindex_t(columnIndex + 1)
+const root = columnindex_t(0)
 
-				nup[node] = nup[chead[columnIndex+1]]
-				ndown[nup[chead[columnIndex+1]]] = node
+/*
+Iterator returns an Iterator over the solutions of the matrix. It stops when ctx is cancelled.
+*/
+func (m *Matrix[T]) Iterator(ctx context.Context) *Iterator[T] {
+	numColumns := len(m.names)
+	numNodes := numColumns + 1
+	for i := range m.rows {
+		numNodes += len(m.rows[i].Columns)
+	}
+	it := &Iterator[T]{
+		ctx:      ctx,
+		rows:     m.rows[:len(m.rows):len(m.rows)],
+		nleft:    make([]nodeindex_t, numNodes),
+		nright:   make([]nodeindex_t, numNodes),
+		nup:      make([]nodeindex_t, numNodes),
+		ndown:    make([]nodeindex_t, numNodes),
+		ncol:     make([]columnindex_t, numNodes),
+		nrow:     make([]int, numNodes),
+		ncolor:   make([]int, numNodes),
+		chead:    make([]nodeindex_t, numColumns+1),
+		clen:     make([]nodeindex_t, numColumns+1),
+		cprev:    make([]columnindex_t, numColumns+1),
+		cnext:    make([]columnindex_t, numColumns+1),
+		cbound:   make([]int, numColumns+1),
+		cslack:   make([]int, numColumns+1),
+		cpure:    make([]int, numColumns+1),
+		inactive: make([]uint64, (numColumns+1+63)/64),
+	}
+	it.readColumns(m)
+	it.readRows()
+	it.state = forwardState
+	return it
+}
 
-				nup[chead[columnIndex+1]] = node
-				ndown[node] = chead[columnIndex+1]
+/*
+readColumns links the primary columns in the list of the root, the secondary columns are linked to themselves.
+Column c of the matrix is column c+1 of the iterator, the root is column 0.
+*/
+func (it *Iterator[T]) readColumns(m *Matrix[T]) {
+	last := root
+	for c := range m.names {
+		column := columnindex_t(c + 1)
+		head := nodeindex_t(c + 1)
+		it.nup[head] = head
+		it.ndown[head] = head
+		it.ncol[head] = column
+		it.chead[column] = head
+		it.clen[column] = 0
+		it.cbound[column] = m.upper[c]
+		it.cslack[column] = m.upper[c] - m.lower[c]
+		if m.secondary[c] {
+			it.cprev[column] = column
+			it.cnext[column] = column
+			continue
+		}
+		if m.lower[c] != 1 || m.upper[c] != 1 {
+			it.bounded = append(it.bounded, column)
+		}
+		it.cprev[column] = last
+		it.cnext[last] = column
+		last = column
+	}
+	// Link the last primary column to wrap back into the root
+	it.cnext[last] = root
+	it.cprev[root] = last
+}
 
-				clen[columnIndex+1] += 1
-				curNodeIndex += 1
+func (it *Iterator[T]) readRows() {
+	curNodeIndex := nodeindex_t(len(it.chead))
+	for i := range it.rows {
+		rowStart := curNodeIndex
+		it.colored = it.colored || it.rows[i].Colors != nil
+		for j, c := range it.rows[i].Columns {
+			node := curNodeIndex
+			column := columnindex_t(c + 1)
+			it.nrow[node] = i
+			if it.rows[i].Colors != nil {
+				it.ncolor[node] = it.rows[i].Colors[j]
 			}
+			it.ncol[node] = column
+			it.nleft[node] = node - 1
+			it.nright[node] = node + 1
+
+			head := it.chead[column]
+			it.nup[node] = it.nup[head]
+			it.ndown[it.nup[head]] = node
+			it.nup[head] = node
+			it.ndown[node] = head
 
-			nleft[rowStart] = curNodeIndex - 1
-			nright[curNodeIndex-1] = rowStart
+			it.clen[column] += 1
+			curNodeIndex += 1
 		}
+		it.nleft[rowStart] = curNodeIndex - 1
+		it.nright[curNodeIndex-1] = rowStart
 	}
+}
 
-	var cover = func(c columnindex_t) {
-		// Unlink column
-		cnext[cprev[c]] = cnext[c]
-		cprev[cnext[c]] = cprev[c]
+func (it *Iterator[T]) cover(c columnindex_t) {
+	it.deactivate(c)
+	// From top to bottom hide every row of the column
+	for rr := it.ndown[it.chead[c]]; rr != it.chead[c]; rr = it.ndown[rr] {
+		it.hide(rr)
+	}
+}
 
-		// From top to bottom, left to right unlink every row node from its column
-		for rr := ndown[chead[c]]; rr != chead[c]; rr = ndown[rr] {
-			for nn := nright[rr]; nn != rr; nn = nright[nn] {
-				ndown[nup[nn]] = ndown[nn]
-				nup[ndown[nn]] = nup[nn]
+func (it *Iterator[T]) uncover(c columnindex_t) {
+	// From bottom to top unhide every row of the column
+	for rr := it.nup[it.chead[c]]; rr != it.chead[c]; rr = it.nup[rr] {
+		it.unhide(rr)
+	}
+	it.activate(c)
+}
 
-				clen[ncol[nn]] -= 1
-			}
+/*
+deactivate unlinks column c from the list of the root, the search no longer chooses rows for it
+*/
+func (it *Iterator[T]) deactivate(c columnindex_t) {
+	it.cnext[it.cprev[c]] = it.cnext[c]
+	it.cprev[it.cnext[c]] = it.cprev[c]
+	it.inactive[c>>6] |= 1 << (c & 63)
+}
+
+func (it *Iterator[T]) activate(c columnindex_t) {
+	it.cnext[it.cprev[c]] = c
+	it.cprev[it.cnext[c]] = c
+	it.inactive[c>>6] &^= 1 << (c & 63)
+}
+
+/*
+hide unlinks the other nodes of the row of node rr from their columns.
+Nodes that have the color of a purified column are already out of the way.
+*/
+func (it *Iterator[T]) hide(rr nodeindex_t) {
+	for nn := it.nright[rr]; nn != rr; nn = it.nright[nn] {
+		if it.ncolor[nn] < 0 {
+			continue
 		}
+		it.ndown[it.nup[nn]] = it.ndown[nn]
+		it.nup[it.ndown[nn]] = it.nup[nn]
+		it.clen[it.ncol[nn]] -= 1
 	}
+}
 
-	var uncover = func(c columnindex_t) {
-		// From bottom to top, right to left relink every row node to its column
-		//		var uu, dd nodeindex_t
-		for rr := nup[chead[c]]; rr != chead[c]; rr = nup[rr] {
-			for nn := nleft[rr]; nn != rr; nn = nleft[nn] {
+func (it *Iterator[T]) unhide(rr nodeindex_t) {
+	for nn := it.nleft[rr]; nn != rr; nn = it.nleft[nn] {
+		if it.ncolor[nn] < 0 {
+			continue
+		}
+		it.ndown[it.nup[nn]] = nn
+		it.nup[it.ndown[nn]] = nn
+		it.clen[it.ncol[nn]] += 1
+	}
+}
 
-				ndown[nup[nn]] = nn
-				nup[ndown[nn]] = nn
+/*
+commit uses the column of node pp for the chosen row: it lowers its bound and covers it when the bound runs out,
+or it purifies the column when pp has a color
+*/
+func (it *Iterator[T]) commit(pp nodeindex_t) {
+	if color := it.ncolor[pp]; color == 0 {
+		c := it.ncol[pp]
+		it.cbound[c]--
+		if it.cbound[c] == 0 {
+			it.cover(c)
+		}
+	} else if color > 0 {
+		it.purify(pp)
+	}
+}
 
-				clen[ncol[nn]] += 1
-			}
+func (it *Iterator[T]) uncommit(pp nodeindex_t) {
+	if color := it.ncolor[pp]; color == 0 {
+		c := it.ncol[pp]
+		if it.cbound[c] == 0 {
+			it.uncover(c)
 		}
+		it.cbound[c]++
+	} else if color > 0 {
+		it.unpurify(pp)
+	}
+}
 
-		// Unlink column
-		cnext[cprev[c]] = c
-		cprev[cnext[c]] = c
+/*
+purify hides the rows that give the column of pp another color,
+and marks the nodes of the rows with the same color so they leave the column alone
+*/
+func (it *Iterator[T]) purify(pp nodeindex_t) {
+	color, head := it.ncolor[pp], it.chead[it.ncol[pp]]
+	it.cpure[it.ncol[pp]] = color
+	for rr := it.ndown[head]; rr != head; rr = it.ndown[rr] {
+		if it.ncolor[rr] == color {
+			it.ncolor[rr] = -1
+		} else {
+			it.hide(rr)
+		}
 	}
+}
 
-	var pickBestColum = func() {
-		lowestLen := clen[cnext[root]]
-		lowest := cnext[root]
+func (it *Iterator[T]) unpurify(pp nodeindex_t) {
+	color, head := it.ncolor[pp], it.chead[it.ncol[pp]]
+	it.cpure[it.ncol[pp]] = 0
+	for rr := it.nup[head]; rr != head; rr = it.nup[rr] {
+		if it.ncolor[rr] < 0 {
+			it.ncolor[rr] = color
+		} else {
+			it.unhide(rr)
+		}
+	}
+}
 
-		for curCol := cnext[root]; curCol != root; curCol = cnext[curCol] {
-			length := clen[curCol]
-			if length < lowestLen {
-				lowestLen = length
-				lowest = curCol
-			}
+/*
+tweak takes row x, the first row of column c, out of the column so the rows of c that follow can not choose it again.
+While c is not covered, the other nodes of the row are hidden as well.
+*/
+func (it *Iterator[T]) tweak(x nodeindex_t, c columnindex_t) {
+	if it.cbound[c] != 0 {
+		it.hide(x)
+	}
+	head := it.chead[c]
+	it.ndown[head] = it.ndown[x]
+	it.nup[it.ndown[x]] = head
+	it.clen[c] -= 1
+}
+
+/*
+untweak puts the rows of column c back that were taken out since row x, the first row the level tried
+*/
+func (it *Iterator[T]) untweak(x nodeindex_t, c columnindex_t) {
+	head := it.chead[c]
+	last := it.ndown[head]
+	it.ndown[head] = x
+	prev := head
+	for ; x != last; x = it.ndown[x] {
+		it.nup[x] = prev
+		if it.cbound[c] != 0 {
+			it.unhide(x)
 		}
+		it.clen[c] += 1
+		prev = x
+	}
+	it.nup[last] = prev
+}
 
-		bestCol = lowest
+/*
+pickBestColumn picks the column with the fewest ways to go on, and returns false if it has none:
+the number of rows that can cover it, plus 1 when it can stay as it is because its minimum is reached.
+*/
+func (it *Iterator[T]) pickBestColumn() bool {
+	lowest := -1
+	for curCol := it.cnext[root]; curCol != root; curCol = it.cnext[curCol] {
+		branches := max(int(it.clen[curCol])+1-max(it.cbound[curCol]-it.cslack[curCol], 0), 0)
+		if lowest < 0 || branches < lowest {
+			lowest = branches
+			it.bestCol = curCol
+		}
+	}
+	return lowest > 0
+}
+
+/*
+enterColumn starts the level on the best column: the first row of the column is the first to try
+*/
+func (it *Iterator[T]) enterColumn() {
+	c := it.bestCol
+	it.currentNode = it.ndown[it.chead[c]]
+	if it.level == len(it.choice) {
+		it.choice = append(it.choice, it.currentNode)
+		it.first = append(it.first, it.currentNode)
+		it.branch = append(it.branch, 0)
+	} else {
+		it.choice[it.level] = it.currentNode
+		it.first[it.level] = it.currentNode
+		it.branch[it.level] = 0
+	}
+	it.cbound[c]--
+	if it.cbound[c] == 0 {
+		it.cover(c)
 	}
+}
 
-	var recordSolution = func() {
-		results := []result_t{}
-		for l := 0; l <= level; l++ {
-			node := choice[l]
-			results = append(results, result_t{nindex[node], ndata[node]})
+/*
+leave goes back to the previous level, to try the next row of its column
+*/
+func (it *Iterator[T]) leave() {
+	if it.level == 0 {
+		it.state = doneState
+		return
+	}
+	it.level = it.level - 1
+	it.currentNode = it.choice[it.level]
+	it.bestCol = it.ncol[it.currentNode]
+	if it.currentNode == it.chead[it.bestCol] {
+		// the level took its column out of the list without covering it, it has no more rows to try
+		if it.cbound[it.bestCol] != 0 {
+			it.activate(it.bestCol)
 		}
-		solutions = append(solutions, results)
+		it.state = backupState
+		return
 	}
+	it.state = recoverState
+}
 
-	//	stateMethods := []func(){forward, advance, backup, recover, done}
+func (it *Iterator[T]) recordSolution() {
+	it.solution = it.solution[:0]
+	for l := 0; l < it.level; l++ {
+		if node := it.choice[l]; int(node) >= len(it.chead) {
+			it.solution = append(it.solution, &it.rows[it.nrow[node]])
+		}
+	}
+}
 
-	readColumnNames()
-	readRows()
+/*
+residualKey identifies the residual problem: the columns that are inactive, the bounds of the columns with
+a multiplicity and the first row they can still choose, and the colors of the purified columns
+*/
+func (it *Iterator[T]) residualKey() string {
+	key := make([]byte, 0, 8*len(it.inactive)+4*len(it.bounded))
+	for _, w := range it.inactive {
+		key = binary.LittleEndian.AppendUint64(key, w)
+	}
+	for _, c := range it.bounded {
+		key = binary.AppendUvarint(key, uint64(it.cbound[c]))
+		key = binary.AppendUvarint(key, uint64(it.ndown[it.chead[c]]))
+	}
+	if it.colored {
+		for _, color := range it.cpure {
+			key = binary.AppendUvarint(key, uint64(color))
+		}
+	}
+	return string(key)
+}
 
-	for running {
-		switch currentSearchState {
+/*
+search runs the statemachine of Algorithm M until it finds a solution or it is done. In count mode it only stops when done.
+*/
+func (it *Iterator[T]) search() bool {
+	for {
+		switch it.state {
 		case forwardState:
-			// pick the best column to process, and select the first node of the first row (currentNode)
-			pickBestColum()
-			cover(bestCol)
-			currentNode = ndown[chead[bestCol]]
-			choice[level] = currentNode
-			currentSearchState = advanceState
-		case advanceState:
-			// analyze the selected row from the previous step
+			// enter a new level
 			// either go to:
-			//   backupState (deadend, rollback because there is no row to process)
-			//   doneState (solution found, but we reached the limit of numSolutions to find)
-			//   recoverState (solution found, we need to move on to find more solutions)
-			//   forwardState (no solution yet, no deadend yet, go to the next column)
-			if currentNode == chead[bestCol] {
-				// if the currentNode == the header, then this column has 0 selectable rows
-				currentSearchState = backupState
+			//   advanceState (try the first row of the best column)
+			//   recoverState or backupState of the previous level (solution found, or a deadend)
+			//   doneState (stopped by the context or the budget)
+			it.steps++
+			if it.MaxSteps > 0 && it.steps > it.MaxSteps {
+				it.err = ErrBudgetExceeded
+				it.state = doneState
 				break
 			}
-			for pp := nright[currentNode]; pp != currentNode; pp = nright[pp] {
-				// cover all the columns for the row containing currentNode
-				cover(ncol[pp])
+			if it.steps%checkInterval == 0 {
+				if err := it.ctx.Err(); err != nil {
+					it.err = err
+					it.state = doneState
+					break
+				}
+				if it.Progress != nil {
+					it.Progress(it.steps, it.level, it.count)
+				}
+				if it.check != nil {
+					if err := it.check(); err != nil {
+						it.err = err
+						it.state = doneState
+						break
+					}
+				}
+			}
+			if it.split != nil && (it.level == it.depth || it.cnext[root] == root) {
+				// the subtree of this level is searched by a worker
+				it.split(it.branch[:it.level])
+				it.leave()
+				break
 			}
-			if cnext[root] == root {
+			if it.cnext[root] == root {
 				// if there are no remaining columns to process, we have a solution
-				recordSolution()
-				if len(solutions) == numSolutions {
-					currentSearchState = doneState
-				} else {
-					currentSearchState = recoverState
+				it.count++
+				if it.counting {
+					it.leave()
+					break
 				}
+				it.recordSolution()
+				it.leave()
+				return true
+			}
+			if it.memo != nil && it.level >= len(it.lo) {
+				// the levels of lo do not search every choice, their count is not the one of the residual problem
+				key := it.residualKey()
+				if n, ok := it.memo[key]; ok {
+					// the residual problem was searched before
+					it.count += n
+					it.leave()
+					break
+				}
+				for len(it.memoKey) <= it.level {
+					it.memoKey = append(it.memoKey, "")
+					it.memoStart = append(it.memoStart, 0)
+				}
+				it.memoKey[it.level], it.memoStart[it.level] = key, it.count
+			}
+			if !it.pickBestColumn() {
+				it.leave()
 				break
 			}
-			level = level + 1
-			currentSearchState = forwardState
-		case backupState:
-			// recover from a deadend, go a level back
+			it.enterColumn()
+			it.state = advanceState
+		case advanceState:
+			// analyze the selected row
 			// either go to:
-			//    doneState (if we are back at level 0, we are done)
-			//    recoverState (continue the hunt for a solution)
-			uncover(bestCol)
-			if level == 0 {
-				currentSearchState = doneState
+			//   backupState (deadend, rollback because there is no row to process)
+			//   forwardState (go to the next level with the row, or with the column left as it is)
+			c, x := it.bestCol, it.currentNode
+			if l := it.level; l < len(it.lo) && ((it.hi[l] >= 0 && it.branch[l] > it.hi[l]) || (x == it.chead[c] && it.branch[l] < it.lo[l])) {
+				// the choices that are left are outside the subtree
+				it.state = backupState
+				break
+			}
+			if it.cbound[c] == 0 && it.cslack[c] == 0 {
+				// the column was covered exactly
+				if x == it.chead[c] {
+					it.state = backupState
+					break
+				}
+			} else {
+				if int(it.clen[c]) <= it.cbound[c]-it.cslack[c] {
+					// the rows that are left can not reach the minimum of the column
+					it.state = backupState
+					break
+				}
+				if x != it.chead[c] {
+					it.tweak(x, c)
+				} else if it.cbound[c] != 0 {
+					// no more rows for this column
+					it.deactivate(c)
+				}
+			}
+			if x != it.chead[c] {
+				for pp := it.nright[x]; pp != x; pp = it.nright[pp] {
+					// use all the columns for the row containing currentNode
+					it.commit(pp)
+				}
+			}
+			if it.level < len(it.lo) && it.branch[it.level] < it.lo[it.level] {
+				// the row comes before the subtree, undo it and try the next one
+				it.state = recoverState
 				break
 			}
-			level = level - 1
-			currentNode = choice[level]
-			bestCol = ncol[currentNode]
-			currentSearchState = recoverState
+			it.level = it.level + 1
+			it.state = forwardState
+		case backupState:
+			// every row of the column was tried, restore the column and go a level back
+			c := it.bestCol
+			if it.cbound[c] == 0 && it.cslack[c] == 0 {
+				it.uncover(c)
+			} else {
+				it.untweak(it.first[it.level], c)
+				if it.cbound[c] == 0 {
+					it.uncover(c)
+				}
+			}
+			it.cbound[c]++
+			if it.memo != nil && it.level >= len(it.lo) && it.level < len(it.memoKey) && it.memoKey[it.level] != "" && len(it.memo) < maxMemo {
+				it.memo[it.memoKey[it.level]] = it.count - it.memoStart[it.level]
+			}
+			it.leave()
 		case recoverState:
-			// uncover the current row
+			// undo the current row
 			// move on to the next potential row for the current column
 			// go to:
 			//   advanceState (analyze the selected row)
-			for pp := nleft[currentNode]; pp != currentNode; pp = nleft[pp] {
-				uncover(ncol[pp])
+			for pp := it.nleft[it.currentNode]; pp != it.currentNode; pp = it.nleft[pp] {
+				it.uncommit(pp)
 			}
-			currentNode = ndown[currentNode]
-			choice[level] = currentNode
-			currentSearchState = advanceState
+			it.currentNode = it.ndown[it.currentNode]
+			it.choice[it.level] = it.currentNode
+			it.branch[it.level]++
+			it.state = advanceState
 		case doneState:
 			// we're done, go home
-			running = false
+			it.solution = nil
+			return false
 		}
 	}
+}
+
+/*
+Next searches the next solution, it returns false when there are no more solutions,
+ctx was cancelled or MaxSteps was exceeded
+*/
+func (it *Iterator[T]) Next() bool {
+	return it.search()
+}
+
+/*
+Count counts the solutions that Next did not return yet, without recording them.
+With memoize it remembers the number of solutions of every residual problem it searched,
+and counts a residual problem it meets again at once. That costs time and memory when they rarely repeat.
+*/
+func (it *Iterator[T]) Count(memoize bool) int {
+	it.counting = true
+	before := it.count
+	if memoize {
+		it.memo = make(map[string]int)
+		// the levels that started before do not have a key
+		clear(it.memoKey)
+	}
+	it.search()
+	return it.count - before
+}
+
+/*
+Solution returns the rows of the last solution that Next found, in the order they were chosen.
+The slice is reused by the next call to Next.
+*/
+func (it *Iterator[T]) Solution() []*Row[T] {
+	return it.solution
+}
 
-	return solutions
+/*
+Steps returns the number of steps forward the search took
+*/
+func (it *Iterator[T]) Steps() int {
+	return it.steps
+}
+
+/*
+Err returns the error that stopped the search: the error of the context or ErrBudgetExceeded
+*/
+func (it *Iterator[T]) Err() error {
+	return it.err
 }
@@ -0,0 +1,362 @@
+package dlx
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// maxSplitDepth is the deepest level Parallel splits at when it picks the depth itself
+const maxSplitDepth = 6
+
+// subtreesPerWorker is the number of subtrees Parallel wants for every worker when it picks the depth itself
+const subtreesPerWorker = 4
+
+/*
+Parallel splits the search over several goroutines. The choices of the first levels divide the search tree in
+subtrees, and the workers search them one by one, every worker with an Iterator of its own and so with its own
+copy of the links. Search passes the solutions to visit in the same order as an Iterator finds them,
+so the solutions of a subtree wait until the subtrees before it are done.
+Set the fields before the call to Search or Count.
+*/
+type Parallel[T any] struct {
+	Workers int // the number of goroutines, 0 means runtime.GOMAXPROCS(0)
+	Depth   int // split the tree at this level, 0 splits it deep enough to have a few subtrees for every worker
+	// Steal lets an idle worker take the choices a busy worker did not try yet, when the subtrees are of very uneven size
+	Steal    bool
+	MaxSteps int // stop with ErrBudgetExceeded after about this many steps forward of all the workers, 0 means no limit
+	// Progress is called every 1024 steps of a worker when it is set, with the steps of all the workers,
+	// the level of the worker and the solutions found. The calls do not overlap.
+	Progress func(steps, level, solutions int)
+
+	m   *Matrix[T]
+	ctx context.Context
+	err error
+
+	mu       sync.Mutex
+	changed  *sync.Cond
+	pending  []*subtree_t[T] // the subtrees that no worker took yet
+	head     *subtree_t[T]   // the first subtree that is not passed to visit yet
+	busy     int             // the number of workers that search a subtree
+	hungry   atomic.Int32    // the number of workers that wait for a subtree
+	stopped  bool
+	cancel   context.CancelFunc
+	progress sync.Mutex
+	steps    atomic.Int64
+	count    atomic.Int64
+}
+
+/*
+subtree_t is the part of the search a worker takes: level l < len(lo) tries the choices lo[l] up to hi[l].
+The subtrees are linked in the order of the search.
+*/
+type subtree_t[T any] struct {
+	lo, hi    []int
+	solutions [][]*Row[T] // the solutions that are not passed to visit yet
+	done      bool
+	next      *subtree_t[T]
+}
+
+/*
+Parallel returns a Parallel search of the matrix. It stops when ctx is cancelled.
+*/
+func (m *Matrix[T]) Parallel(ctx context.Context) *Parallel[T] {
+	p := &Parallel[T]{m: m, ctx: ctx}
+	p.changed = sync.NewCond(&p.mu)
+	return p
+}
+
+/*
+Search calls visit for every solution, in the order of Iterator, until visit returns false.
+It returns ctx.Err() when the search was cancelled, or ErrBudgetExceeded.
+Then visit got the first solutions of the search, up to the first subtree that was not searched completely.
+*/
+func (p *Parallel[T]) Search(visit func(solution []*Row[T]) bool) error {
+	var wg sync.WaitGroup
+	if !p.start(&wg, false, false) {
+		return p.err
+	}
+	p.mu.Lock()
+	for p.head != nil && p.err == nil {
+		t := p.head
+		if len(t.solutions) > 0 {
+			solutions := t.solutions
+			t.solutions = nil
+			p.mu.Unlock()
+			for _, solution := range solutions {
+				if !visit(solution) {
+					p.stop(nil)
+					wg.Wait()
+					return p.err
+				}
+			}
+			p.mu.Lock()
+			continue
+		}
+		if t.done {
+			p.head = t.next
+			continue
+		}
+		p.changed.Wait()
+	}
+	p.mu.Unlock()
+	wg.Wait()
+	// after an error, pass the solutions up to the first subtree that was not searched completely,
+	// so they are the first solutions of the serial search
+	for t := p.head; t != nil; t = t.next {
+		for _, solution := range t.solutions {
+			if !visit(solution) {
+				return p.err
+			}
+		}
+		if !t.done {
+			break
+		}
+	}
+	return p.err
+}
+
+/*
+Count counts the solutions. With memoize every worker remembers the number of solutions
+of the residual problems it searched, see Iterator.Count.
+*/
+func (p *Parallel[T]) Count(memoize bool) int {
+	var wg sync.WaitGroup
+	if p.start(&wg, true, memoize) {
+		wg.Wait()
+	}
+	return int(p.count.Load())
+}
+
+/*
+Steps returns the number of steps forward of all the workers, the split of the tree is not counted
+*/
+func (p *Parallel[T]) Steps() int {
+	return int(p.steps.Load())
+}
+
+/*
+Err returns the error that stopped the search: the error of the context or ErrBudgetExceeded
+*/
+func (p *Parallel[T]) Err() error {
+	return p.err
+}
+
+/*
+start splits the tree and starts the workers, it returns false when the split was stopped
+*/
+func (p *Parallel[T]) start(wg *sync.WaitGroup, counting, memoize bool) bool {
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(p.ctx)
+	subtrees, err := p.split(workers)
+	if err != nil {
+		p.err = err
+		p.cancel()
+		return false
+	}
+	for i := range subtrees {
+		if i+1 < len(subtrees) {
+			subtrees[i].next = subtrees[i+1]
+		}
+	}
+	p.pending = subtrees
+	if len(subtrees) > 0 {
+		p.head = subtrees[0]
+	}
+	for w := 0; w < workers; w++ {
+		it := p.m.Iterator(ctx)
+		it.counting = counting
+		if memoize {
+			it.memo = make(map[string]int)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(it)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		p.cancel()
+	}()
+	return true
+}
+
+/*
+split returns the subtrees of the levels below Depth, in the order of the search.
+A solution that is found above that level is a subtree of its own.
+When it picks the depth itself, it splits the subtrees of a level one level deeper until there are enough.
+The steps of the split are not counted in MaxSteps, the workers search the subtrees again anyway.
+*/
+func (p *Parallel[T]) split(workers int) ([]*subtree_t[T], error) {
+	var subtrees []*subtree_t[T]
+	deeper := false
+	it := p.m.Iterator(p.ctx)
+	it.depth = max(p.Depth, 1)
+	it.split = func(branch []int) {
+		deeper = deeper || len(branch) == it.depth
+		subtrees = append(subtrees, &subtree_t[T]{lo: slices.Clone(branch), hi: slices.Clone(branch)})
+	}
+	it.search()
+	for it.err == nil && p.Depth == 0 && deeper && len(subtrees) < subtreesPerWorker*workers && it.depth < maxSplitDepth {
+		parents := subtrees
+		subtrees, deeper = nil, false
+		it.depth++
+		for _, t := range parents {
+			if len(t.lo) < it.depth-1 {
+				// a solution above the level of the split
+				subtrees = append(subtrees, t)
+				continue
+			}
+			it.lo, it.hi = t.lo, t.hi
+			it.level = 0
+			it.state = forwardState
+			if it.search(); it.err != nil {
+				break
+			}
+		}
+	}
+	if it.err != nil {
+		return nil, it.err
+	}
+	return subtrees, nil
+}
+
+/*
+work searches the subtrees until there are none left
+*/
+func (p *Parallel[T]) work(it *Iterator[T]) {
+	var t *subtree_t[T]
+	steps, count := 0, 0
+	// report adds the steps and solutions since the last report to the ones of all the workers
+	report := func() {
+		p.steps.Add(int64(it.steps - steps))
+		p.count.Add(int64(it.count - count))
+		steps, count = it.steps, it.count
+	}
+	it.check = func() error {
+		report()
+		if p.MaxSteps > 0 && p.Steps() > p.MaxSteps {
+			return ErrBudgetExceeded
+		}
+		if p.Progress != nil {
+			p.progress.Lock()
+			p.Progress(p.Steps(), it.level, int(p.count.Load()))
+			p.progress.Unlock()
+		}
+		if p.Steal && p.hungry.Load() > 0 {
+			p.share(it, t)
+		}
+		return nil
+	}
+	for t = p.take(); t != nil; t = p.take() {
+		it.lo, it.hi = t.lo, t.hi
+		it.level = 0
+		it.state = forwardState
+		for it.search() {
+			solution := slices.Clone(it.Solution())
+			p.mu.Lock()
+			t.solutions = append(t.solutions, solution)
+			if t == p.head {
+				p.changed.Broadcast()
+			}
+			p.mu.Unlock()
+		}
+		report()
+		p.mu.Lock()
+		// a subtree that was stopped is not done, the solutions of the subtrees after it do not follow its solutions
+		t.done = it.err == nil
+		p.busy--
+		p.changed.Broadcast()
+		p.mu.Unlock()
+		if it.err != nil {
+			p.stop(it.err)
+			return
+		}
+	}
+}
+
+/*
+take returns the next subtree, or nil when the search is done. With Steal it waits while other workers are busy.
+*/
+func (p *Parallel[T]) take() *subtree_t[T] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.pending) == 0 {
+		if p.stopped || !p.Steal || p.busy == 0 {
+			return nil
+		}
+		p.hungry.Add(1)
+		p.changed.Wait()
+		p.hungry.Add(-1)
+	}
+	if p.stopped {
+		return nil
+	}
+	t := p.pending[0]
+	p.pending = p.pending[1:]
+	p.busy++
+	return t
+}
+
+/*
+share gives the choices of the shallowest level that the worker did not try yet to a new subtree,
+the worker keeps the choice it is searching now
+*/
+func (p *Parallel[T]) share(it *Iterator[T], t *subtree_t[T]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped || int(p.hungry.Load()) <= len(p.pending) {
+		return
+	}
+	for l := 0; l < it.level; l++ {
+		x := it.choice[l]
+		c := it.ncol[x]
+		if l < len(it.lo) && it.hi[l] >= 0 && it.branch[l] >= it.hi[l] {
+			continue
+		}
+		if x == it.chead[c] || (it.ndown[x] == it.chead[c] && !slices.Contains(it.bounded, c)) {
+			// the column has no rows left, only a column with a multiplicity can stay as it is
+			continue
+		}
+		hi := -1
+		if l < len(it.hi) {
+			hi = it.hi[l]
+		}
+		stolen := &subtree_t[T]{lo: slices.Clone(it.branch[:l+1]), hi: slices.Clone(it.branch[:l+1]), next: t.next}
+		stolen.lo[l]++
+		stolen.hi[l] = hi
+		// the levels up to l try no other choices now, so their counts do not go in the memo
+		if l >= len(it.lo) {
+			it.lo = append(slices.Clone(it.lo), it.branch[len(it.lo):l+1]...)
+			it.hi = append(slices.Clone(it.hi), it.branch[len(it.hi):l+1]...)
+		} else {
+			it.hi = slices.Clone(it.hi)
+			it.hi[l] = it.branch[l]
+		}
+		t.next = stolen
+		p.pending = append(p.pending, stolen)
+		p.changed.Broadcast()
+		return
+	}
+}
+
+/*
+stop ends the search, err is the error that stopped it
+*/
+func (p *Parallel[T]) stop(err error) {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		p.err = err
+	}
+	p.changed.Broadcast()
+	p.mu.Unlock()
+	p.cancel()
+}
@@ -1,35 +1,147 @@
 package solver
 
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
 //	dlx "github.com/Kappeh/dlx"
 
-type assembly_t []*annotation_t
+/*
+Assembly_t is one assembly of a problem: the placement of every piece in the result
+*/
+type Assembly_t []*annotation_t
+
+/*
+EachAssembly calls f for every assembly of the problem, as soon as the assembler finds it.
+Return false from f to stop. The assemblies are not cached, f can keep them.
+
+The result is true when the assembler stopped because MaxAssemblies assemblies were found,
+there may be more assemblies than the ones passed to f.
+*/
+func (sc *ProblemCache_t) EachAssembly(f func(Assembly_t) bool) (limitReached bool) {
+	limitReached, _ = sc.EachAssemblyContext(context.Background(), f)
+	return limitReached
+}
 
-func (sc ProblemCache_t) assemble() (solutions []assembly_t) {
-	tempMatrix := sc.getDLXmatrix()
-	searchConfig := NewSearchconfig(sc)
-	searchConfig.NumSolutions = 1000000
-	for _, entry := range *tempMatrix {
-		searchConfig.AddRow(*entry.row, *entry.annotation)
+/*
+EachAssemblyContext is EachAssembly that stops when ctx is cancelled or MaxSearchSteps is exceeded,
+and then returns ctx.Err() or ErrBudgetExceeded.
+*/
+func (sc *ProblemCache_t) EachAssemblyContext(ctx context.Context, f func(Assembly_t) bool) (limitReached bool, err error) {
+	searchConfig := sc.newSearchconfig()
+	var filter *assemblyFilter_t
+	if sc.DropDuplicates || sc.DropMirrors {
+		filter = sc.newAssemblyFilter(sc.DropMirrors)
 	}
-	res := searchConfig.Search()
-	for i := range res {
-		solution := assembly_t{}
-		for _, row := range res[i] {
+	// count here instead of with NumSolutions, duplicates do not count
+	found := 0
+	searchConfig.OnSolution = func(res []result_t) bool {
+		solution := Assembly_t{}
+		for _, row := range res {
 			annot := row.GetData().(annotation_t)
 			solution = append(solution, &annot)
 		}
-		solutions = append(solutions, solution)
+		if filter != nil && filter.isDuplicate(solution) {
+			return true
+		}
+		found++
+		if !f(solution) {
+			return false
+		}
+		if found == sc.MaxAssemblies {
+			limitReached = true
+			return false
+		}
+		return true
 	}
+	_, err = searchConfig.SearchContext(ctx)
+	sc.duplicatesRemoved = 0
+	if filter != nil {
+		sc.duplicatesRemoved = filter.removed
+	}
+	return limitReached, err
+}
+
+/*
+CountAssemblies returns the number of assemblies of the problem, see CountAssembliesContext
+*/
+func (sc *ProblemCache_t) CountAssemblies() int {
+	count, _ := sc.CountAssembliesContext(context.Background())
+	return count
+}
+
+/*
+CountAssembliesContext counts the assemblies of the problem without keeping them.
+With MemoizeCount the assembler remembers the number of assemblies of every residual problem it searched,
+and counts them at once when it meets the same one again. That costs time and memory when they rarely repeat.
+MaxAssemblies, DropDuplicates and DropMirrors are not used. When ctx is cancelled or MaxSearchSteps is exceeded,
+it returns the assemblies counted so far with ctx.Err() or ErrBudgetExceeded.
+*/
+func (sc *ProblemCache_t) CountAssembliesContext(ctx context.Context) (int, error) {
+	searchConfig := sc.newSearchconfig()
+	searchConfig.CountOnly = true
+	searchConfig.Memoize = sc.MemoizeCount
+	_, err := searchConfig.SearchContext(ctx)
+	return searchConfig.Count, err
+}
+
+func (sc *ProblemCache_t) assemble() (solutions []Assembly_t) {
+	sc.assemblyLimitReached = sc.EachAssembly(func(a Assembly_t) bool {
+		solutions = append(solutions, a)
+		return true
+	})
 	return solutions
 }
 
 /*
 GetAssemblies returns an array of the possible assemblies of the problem (represented by this cache)
 GetAssemblies[x] returns assembly number x
+Check AssemblyLimitReached to see if the list was cut off at MaxAssemblies.
 */
-func (sc *ProblemCache_t) GetAssemblies() []assembly_t {
+func (sc *ProblemCache_t) GetAssemblies() []Assembly_t {
 	if sc.assemblyCache == nil {
+		start := time.Now()
 		sc.assemblyCache = sc.assemble()
+		sc.assemblyTime = time.Since(start)
 	}
 	return sc.assemblyCache
 }
+
+/*
+AssemblyLimitReached returns true if GetAssemblies stopped at MaxAssemblies assemblies
+*/
+func (sc *ProblemCache_t) AssemblyLimitReached() bool {
+	return sc.assemblyLimitReached
+}
+
+/*
+DuplicatesRemoved returns the number of assemblies the last run of the assembler dropped
+with DropDuplicates or DropMirrors
+*/
+func (sc *ProblemCache_t) DuplicatesRemoved() int {
+	return sc.duplicatesRemoved
+}
+
+/*
+EncodeAssembly returns the assembly in the format of BurrTools: "x y z rotation" for every piece
+of the problem, or "x" for a piece that is not used. The position is the one of the hotspot of the
+piece, relative to the hotspot of the result.
+*/
+func (sc *ProblemCache_t) EncodeAssembly(assembly Assembly_t) string {
+	pieces := make([]string, sc.idSize)
+	for i := range pieces {
+		pieces[i] = "x"
+	}
+	origin := sc.resultInstance.hotspot
+	for _, a := range assembly {
+		pos := make([]string, 0, 4)
+		for dim := 0; dim < 3; dim++ {
+			pos = append(pos, strconv.Itoa(int(a.offset[dim])+int(a.hotspot[dim])-int(origin[dim])))
+		}
+		pieces[a.shapeID] = strings.Join(append(pos, strconv.Itoa(int(a.rotation))), " ")
+	}
+	return strings.Join(pieces, " ")
+}
@@ -1,7 +1,13 @@
 package solver
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	swiss "github.com/dolthub/swiss"
 	burrutils "github.com/kgeusens/go/burr-data/burrutils"
@@ -12,6 +18,16 @@ type maxVal_t [3]burrutils.Distance_t
 
 const maxDistance = burrutils.Distance_t(10000)
 
+// ErrBudgetExceeded is returned when the assembler or the solver used up the steps they were given
+var ErrBudgetExceeded = errors.New("solver: budget exceeded")
+
+// ErrTooLarge is returned by SolveContext when the movements of 2 pieces of the problem do not fit in the 64 bit hash,
+// or the pieces can be further apart than a Distance_t holds
+var ErrTooLarge = errors.New("solver: problem too large to hash the movements of its pieces")
+
+// checkInterval is the number of steps between two checks of the context in the search loops
+const checkInterval = 1024
+
 /*
 ProblemCache_t
 
@@ -22,46 +38,109 @@ Informations is either calculated and cached at time of creation,
 or dynamically at time of consultation (and then cached for future).
 */
 type ProblemCache_t struct {
+	MaxAssemblies    int        // stop assembling after this many assemblies, 0 means no limit
+	MaxSearchSteps   int        // steps the assembler can take, 0 means no limit
+	MaxSolveNodes    int        // nodes Solve can analyse for one assembly, 0 means no limit
+	KeepHighestLevel int        // SolveProblem keeps only this many solutions with the highest level, 0 keeps all
+	DropDuplicates   bool       // the assembler skips assemblies that are a symmetry of the result of an assembly it found before
+	DropMirrors      bool       // like DropDuplicates, and it also skips mirror images when every part has a mirror partner
+	ShortestMoves    bool       // Solve moves any group of pieces that can move, so every separation takes the fewest moves
+	MemoizeCount     bool       // CountAssemblies caches the number of assemblies of every residual problem it searched
+	AssemblyWorkers  int        // goroutines the assembler splits its search over, 0 and 1 search in the calling goroutine
+	AssemblySteal    bool       // with AssemblyWorkers, an idle goroutine takes over part of the search of a busy one
+	Observer         Observer_t // when set, it gets the progress of the assembler and the solver
 	// these are unique per problem
 	puzzle         *xmpuzzle.Puzzle
 	problemIndex   uint
 	idSize         int
+	worldOrigin    int // the offsets between 2 pieces in getMaxValues are in [-worldOrigin,worldOrigin]
+	worldMax       int // 2*worldOrigin+1, or 0 when the movement hash does not fit in 64 bits
 	numPrimary     int
 	numSecondary   int
 	shapemap       []burrutils.Id_t
 	resultVoxel    *xmpuzzle.Voxel
 	resultInstance *VoxelInstance
-	instanceCache  map[uint]*VoxelInstance
+	instanceCache  []*VoxelInstance // every rotation of every piece, calculated up front so it can be shared by goroutines
 	//	movementCache  map[uint64]*maxVal_t // cache for getMaxValue
-	movementCache  swiss.Map[uint64, *maxVal_t]
-	dlxMatrixCache *matrix_t        // used by the DLX algorithm in assemble phase, contains the full DLX matrix
-	assemblyCache  []assembly_t     // result of the assemble phase
-	dlxLookupmap   map[maxVal_t]int // used to calculate a row in the DLX matrix. Static throughout the cache lifecycle
+	movementCache        *movementCache_t
+	assembliesAnalysed   *atomic.Int64    // number of assemblies Solve finished, shared by the copies of the cache
+	dlxMatrixCache       *matrix_t        // used by the DLX algorithm in assemble phase, contains the full DLX matrix
+	assemblyCache        []Assembly_t     // result of the assemble phase
+	assemblyLimitReached bool             // true if the assemble phase stopped at MaxAssemblies
+	assemblyTime         time.Duration    // the time the assemble phase of GetAssemblies took
+	duplicatesRemoved    int              // assemblies the last assemble phase dropped as duplicates
+	dlxLookupmap         map[maxVal_t]int // used to calculate a row in the DLX matrix. Static throughout the cache lifecycle
+}
+
+const movementShards = 64
+
+/*
+movementCache_t caches the results of getMaxValues. It is shared by all the goroutines
+that solve assemblies of the same problem, so it is split in shards that each have their own lock.
+*/
+type movementCache_t struct {
+	shards [movementShards]struct {
+		sync.RWMutex
+		m            *swiss.Map[uint64, *maxVal_t]
+		hits, misses atomic.Uint64 // counted per shard, so goroutines do not fight over one counter
+	}
+}
+
+func newMovementCache() *movementCache_t {
+	mc := new(movementCache_t)
+	for i := range mc.shards {
+		mc.shards[i].m = swiss.NewMap[uint64, *maxVal_t](0)
+	}
+	return mc
+}
+
+func (mc *movementCache_t) Get(hash uint64) (pmoves *maxVal_t, ok bool) {
+	shard := &mc.shards[hash%movementShards]
+	shard.RLock()
+	pmoves, ok = shard.m.Get(hash)
+	shard.RUnlock()
+	if ok {
+		shard.hits.Add(1)
+	} else {
+		shard.misses.Add(1)
+	}
+	return
+}
+
+func (mc *movementCache_t) Put(hash uint64, pmoves *maxVal_t) {
+	shard := &mc.shards[hash%movementShards]
+	shard.Lock()
+	shard.m.Put(hash, pmoves)
+	shard.Unlock()
+}
+
+/*
+stats returns the number of hits and misses of all the shards
+*/
+func (mc *movementCache_t) stats() (hits, misses uint64) {
+	for i := range mc.shards {
+		hits += mc.shards[i].hits.Load()
+		misses += mc.shards[i].misses.Load()
+	}
+	return
 }
 
 type SolverCache_t struct {
 	// These are used every time we analyse a potential move in the solver
 	// If we want to operate in parallel, it needs to move to a cache that is unique per Assembly we are solving
-	pc           *ProblemCache_t                                 // pointer to the parent ProblemCache. Can not be nil.
-	cutlerMatrix [3 * maxShapes * maxShapes]burrutils.Distance_t // contains the cutlermatrix for a state in the tree
-	movesList    []*node_t                                       // used in getMovementList to calculate moveable pieces from a state in the tree
+	pc           *ProblemCache_t        // pointer to the parent ProblemCache. Can not be nil.
+	cutlerMatrix []burrutils.Distance_t // contains the cutlermatrix for a state in the tree, 3*idSize*idSize
+	movesList    []*node_t              // used in getMovementList to calculate moveable pieces from a state in the tree
 	nodecache    NodeCache_t
 }
 
-/*
-Needed to calculate hashes
-*/
-const worldOrigin uint64 = 100
-const worldMax uint64 = 2*worldOrigin + 1
-const worldOriginIndex uint64 = worldOrigin * (worldMax*worldMax + worldMax + 1)
-const worldSize uint64 = worldMax * worldMax * worldMax
-
 /*
  */
 func NewSolverCache(pc *ProblemCache_t) (sc SolverCache_t) {
 	psc := new(SolverCache_t)
 	sc = *psc
 	sc.pc = pc
+	sc.cutlerMatrix = make([]burrutils.Distance_t, 3*pc.idSize*pc.idSize)
 	sc.movesList = make([]*node_t, 0, 3*maxShapes)
 	sc.nodecache = NodeCache_t{make([]*node_t, 0)}
 	return
@@ -77,10 +156,32 @@ func NewProblemCache(puzzle *xmpuzzle.Puzzle, problemIdx uint) (pc ProblemCache_
 	pc.shapemap = pc.GetProblem().GetShapemap()
 	pc.idSize = len(pc.shapemap)
 	pc.resultVoxel = &puzzle.Shapes[pc.GetProblem().Result.Id]
+	// Pieces that are not separated overlap along every axis, or the ones on one side could move away.
+	// So 2 pieces are never further apart than all the pieces in a row, and in the start they are in the result.
+	pc.worldOrigin = int(max(pc.resultVoxel.X, pc.resultVoxel.Y, pc.resultVoxel.Z))
+	for _, id := range pc.shapemap {
+		v := &puzzle.Shapes[id]
+		pc.worldOrigin += int(max(v.X, v.Y, v.Z))
+	}
+	pc.worldMax = 2*pc.worldOrigin + 1
+	pairs := uint64(pc.idSize*24) * uint64(pc.idSize*24)
+	if pc.worldOrigin > math.MaxInt16 {
+		// the offsets between the pieces do not fit in a Distance_t
+		pc.worldMax = 0
+	} else if hi, _ := bits.Mul64(pairs, uint64(pc.worldMax*pc.worldMax*pc.worldMax)); hi != 0 {
+		pc.worldMax = 0
+	}
 	resi := NewVoxelinstance(pc.resultVoxel, 0)
 	pc.resultInstance = &resi
-	pc.instanceCache = make(map[uint]*VoxelInstance)
-	pc.movementCache = *swiss.NewMap[uint64, *maxVal_t](0)
+	pc.instanceCache = make([]*VoxelInstance, pc.idSize*24)
+	for id := 0; id < pc.idSize; id++ {
+		for rot := 0; rot < 24; rot++ {
+			instance := NewVoxelinstance(&puzzle.Shapes[pc.shapemap[id]], burrutils.Id_t(rot))
+			pc.instanceCache[id*24+rot] = &instance
+		}
+	}
+	pc.movementCache = newMovementCache()
+	pc.assembliesAnalysed = new(atomic.Int64)
 	//	pc.movementCache = make(map[uint64]*maxVal_t)
 	//	pc.movesList = make([]*node_t, 3*maxShapes)
 
@@ -88,7 +189,7 @@ func NewProblemCache(puzzle *xmpuzzle.Puzzle, problemIdx uint) (pc ProblemCache_
 	// Baseline the resmap by creating 2 arrays:
 	// one for the filled pixels, and one for the vari pixels
 	var filledHashSequence, variHashSequence []maxVal_t
-	for key := range resmap {
+	for key := 0; key < resmap.Size(); key++ {
 		if resmap.Value(key) == 1 {
 			filledHashSequence = append(filledHashSequence, resmap.Position(key))
 		} else {
@@ -126,14 +227,7 @@ func (pc ProblemCache_t) GetNumSecondary() int {
 
 func (pc *ProblemCache_t) GetShapeInstance(id, rot burrutils.Id_t) (vi *VoxelInstance) {
 	// hash is based on 24 max rotations
-	hash := uint(id)*24 + uint(rot)
-	vi = pc.instanceCache[hash]
-	if vi == nil {
-		instance := NewVoxelinstance(&pc.puzzle.Shapes[pc.shapemap[id]], rot)
-		vi = &instance
-		pc.instanceCache[hash] = vi
-	}
-	return
+	return pc.instanceCache[uint(id)*24+uint(rot)]
 }
 
 func (pc ProblemCache_t) GetResultInstance() (vi *VoxelInstance) {
@@ -144,7 +238,9 @@ func (pc ProblemCache_t) GetResultInstance() (vi *VoxelInstance) {
 Calculate a unique uint64 hashvalue for movements
 */
 func (pc *ProblemCache_t) getMaxValues(id1, rot1, id2, rot2 burrutils.Id_t, dx, dy, dz burrutils.Distance_t) (mx, my, mz burrutils.Distance_t) {
-	hash := (((uint64(id1)*24+uint64(rot1))*uint64(pc.idSize)+uint64(id2))*24+uint64(rot2))*worldSize + uint64(int(worldOriginIndex)+int(worldMax)*(int(dz)*int(worldMax)+int(dy))+int(dx))
+	worldMax := uint64(pc.worldMax)
+	offset := uint64(((int(dz)+pc.worldOrigin)*pc.worldMax+int(dy)+pc.worldOrigin)*pc.worldMax + int(dx) + pc.worldOrigin)
+	hash := (((uint64(id1)*24+uint64(rot1))*uint64(pc.idSize)+uint64(id2))*24+uint64(rot2))*worldMax*worldMax*worldMax + offset
 	pmoves, ok := pc.movementCache.Get(hash)
 	if !ok {
 		// now start calculating
@@ -248,18 +344,18 @@ func (pc *ProblemCache_t) getMaxValues(id1, rot1, id2, rot2 burrutils.Id_t, dx,
 	return pmoves[0], pmoves[1], pmoves[2]
 }
 
-func (sc *SolverCache_t) getMovementList(node *node_t) []*node_t {
-	// pRow, pCol can only contain max nPieces, so better preallocate
-	// and reuse instead of doing a lot of append calls.
-	// movelist is a different beast and length is hard to predict.
-
+/*
+fillMovementMatrix fills the cutler matrix with the distances every piece can move relative to every other piece.
+m[j*3*nPieces+i*3+dim] is the distance piece i can move in the positive direction of dim before it hits piece j.
+*/
+func (sc *SolverCache_t) fillMovementMatrix(node *node_t) {
 	nPieces := len(node.root.rootDetails.pieceList)
 	nDims := 3 * nPieces
 	// KG: storing and reusing matrix from the cache can probably save a lot of GC effort
 	//	numRow := nPieces * 3
 	//	var o1, o2 int
 	//	var i, j, k, dim, a int
-	m := &sc.cutlerMatrix
+	m := sc.cutlerMatrix
 	for j := 0; j < nPieces; j++ {
 		for i := 0; i < nPieces; i++ {
 			// diagonal is 0
@@ -274,6 +370,20 @@ func (sc *SolverCache_t) getMovementList(node *node_t) []*node_t {
 			}
 		}
 	}
+}
+
+func (sc *SolverCache_t) getMovementList(node *node_t) []*node_t {
+	// pRow, pCol can only contain max nPieces, so better preallocate
+	// and reuse instead of doing a lot of append calls.
+	// movelist is a different beast and length is hard to predict.
+
+	sc.fillMovementMatrix(node)
+	if sc.pc.ShortestMoves {
+		return sc.getGroupMovementList(node)
+	}
+	nPieces := len(node.root.rootDetails.pieceList)
+	nDims := 3 * nPieces
+	m := sc.cutlerMatrix
 	// Phase 2: algorithm from Bill Cutler
 	again := true
 	var minval burrutils.Distance_t
@@ -393,25 +503,74 @@ func (sc *SolverCache_t) getMovementList(node *node_t) []*node_t {
 	return sc.movesList
 }
 
-func (pc *ProblemCache_t) Solve(assembly assembly_t, asmid int) bool {
-	DEBUG := false
-	if DEBUG {
-		fmt.Println(asmid, " start solving")
+/*
+Solve returns the separation tree of the assembly, or nil if it can not be disassembled
+or MaxSolveNodes was exceeded. See SolveContext
+*/
+func (pc *ProblemCache_t) Solve(assembly Assembly_t, asmid int) *xmpuzzle.Separation {
+	sep, err := pc.SolveContext(context.Background(), assembly, asmid)
+	if err != nil {
+		return nil
 	}
+	return sep
+}
+
+/*
+SolveContext returns the separation tree of the assembly, or nil if it can not be disassembled.
+It gives up when ctx is cancelled or more than MaxSolveNodes nodes were analysed,
+and returns the partial separation tree with ctx.Err() or ErrBudgetExceeded. The partial tree has the
+separations found so far, a sub problem that was not separated yet only has its Type, without pieces or states.
+It is nil when not even the first separation was found. It returns ErrTooLarge right away
+when the problem has too many or too large pieces for the movement hash.
+*/
+func (pc *ProblemCache_t) SolveContext(ctx context.Context, assembly Assembly_t, asmid int) (sep *xmpuzzle.Separation, err error) {
+	if pc.worldMax == 0 {
+		return nil, ErrTooLarge
+	}
+	if len(assembly) <= maxShapes {
+		return solve(ctx, pc, assembly, asmid, (*node_t).GetId)
+	}
+	return solve(ctx, pc, assembly, asmid, (*node_t).GetKey)
+}
+
+/*
+solve is SolveContext with the identity of the nodes in the closed cache given by key
+*/
+func solve[K nodeKey_t](ctx context.Context, pc *ProblemCache_t, assembly Assembly_t, asmid int, key func(*node_t) K) (sep *xmpuzzle.Separation, err error) {
 	sc := NewSolverCache(pc)
 	var startNode *node_t
 	// parking is an array.
 	// push is the same as parking=append(parking, newnode)
 	// pop is the same as parking=parking[:len(parking)-1]
 	parking := []*node_t{sc.nodecache.NewNodeFromAssembly(assembly)}
+	separation := parking[0].rootDetails.separation
+	origin := pc.resultInstance.hotspot
 	var node *node_t
 	var level int
-	closedCache := make(map[id_t]bool)
+	closedCache := make(map[K]bool)
 	// adding an entry to closedCache : closedCache[id]=true
 	// checking if entry exists: closedCache[id]
 	separated := false
 	//	movesList := make([]*node_t, 0, maxShapes)
 	var movesListLength int
+	analysed := 0
+	separations := 0
+	report := func(done bool) {
+		pc.progress(Progress_t{Phase: SolvePhase, Done: done, Assembly: asmid, Nodes: analysed, Level: level, Separations: separations, ClosedCacheSize: len(closedCache)})
+	}
+	// partial returns what was found when the search gives up
+	partial := func() *xmpuzzle.Separation {
+		if separations == 0 {
+			return nil
+		}
+		return separation
+	}
+	defer func() {
+		if err == nil || errors.Is(err, ErrBudgetExceeded) {
+			pc.assembliesAnalysed.Add(1)
+		}
+		report(true)
+	}()
 	for len(parking) > 0 {
 		// pop from parking
 		if startNode != nil {
@@ -423,8 +582,10 @@ func (pc *ProblemCache_t) Solve(assembly assembly_t, asmid int) bool {
 		newListFront := 1
 		openlist := [2][]*node_t{{}, {}}
 		separated = false
+		// the ids of the nodes of different sub problems can be the same
+		clear(closedCache)
 
-		closedCache[startNode.GetId()] = true
+		closedCache[key(startNode)] = true
 		openlist[curListFront] = append(openlist[curListFront], startNode)
 
 		level = 1
@@ -434,10 +595,17 @@ func (pc *ProblemCache_t) Solve(assembly assembly_t, asmid int) bool {
 			curLength -= 1
 			node = openlist[curListFront][curLength]
 			openlist[curListFront] = openlist[curListFront][:curLength]
-			movesList := sc.getMovementList(node)
-			if DEBUG {
-				fmt.Println(asmid, "node", node.GetId())
+			analysed++
+			if pc.MaxSolveNodes > 0 && analysed > pc.MaxSolveNodes {
+				return partial(), ErrBudgetExceeded
 			}
+			if analysed%checkInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return partial(), err
+				}
+				report(false)
+			}
+			movesList := sc.getMovementList(node)
 			var st *node_t
 			movesListLength = len(movesList)
 			for movesListLength != 0 && !separated {
@@ -445,15 +613,12 @@ func (pc *ProblemCache_t) Solve(assembly assembly_t, asmid int) bool {
 				movesListLength -= 1
 				st = movesList[movesListLength]
 				movesList = movesList[:movesListLength]
-				if DEBUG {
-					fmt.Println(asmid, st.movingPieceList, st.moveDirection, st.isSeparation, st.GetId())
-				}
-				if closedCache[st.GetId()] {
+				if closedCache[key(st)] {
 					sc.nodecache.release(st)
 					continue
 				}
 				// never seen this node before, add it to cache
-				closedCache[st.GetId()] = true
+				closedCache[key(st)] = true
 				// check for separation
 				if !st.isSeparation {
 					openlist[newListFront] = append(openlist[newListFront], st)
@@ -462,22 +627,17 @@ func (pc *ProblemCache_t) Solve(assembly assembly_t, asmid int) bool {
 					// this is a separation, put the sub problems on the parking lot and continue to the next one on the parking
 					// Need to record this in the partial solution
 					separated = true // FLAG STOP TO GO TO NEXT ON PARKING
+					separations++
 					parking = append(parking, sc.nodecache.Separate(st)...)
 					// record this separation by walking back up to the root
-					st.RecordSeparationInRoot()
+					st.RecordSeparationInRoot(origin)
 					// now cleanup and release all nodes, except for the root, and this node itself (the parent of the separation)
 					sc.nodecache.Purge()
-					if DEBUG {
-						fmt.Println(asmid, "SEPARATION FOUND level", level)
-					}
 				}
 			}
 			//
 			if len(openlist[curListFront]) == 0 && !separated {
-				if DEBUG {
-					fmt.Println(asmid, "Next Level", level)
-					level++
-				}
+				level++
 				curListFront = 1 - curListFront
 				newListFront = 1 - newListFront
 				curLength = len(openlist[curListFront])
@@ -486,12 +646,110 @@ func (pc *ProblemCache_t) Solve(assembly assembly_t, asmid int) bool {
 		// if we get here, we can check the separated flag to see if it is a dead end, or a separation
 		// if it is a separation, continue to the next on the parking, else return false
 		if !separated {
-			return false
+			return nil, nil
 		}
 	}
 	// SUCCESS
-	if DEBUG {
-		fmt.Println(asmid, "Solution found")
+	return separation, nil
+}
+
+/*
+progress adds the counters of the whole problem to p and passes it to the Observer
+*/
+func (pc *ProblemCache_t) progress(p Progress_t) {
+	if pc.Observer == nil {
+		return
 	}
-	return true
+	p.AssembliesAnalysed = int(pc.assembliesAnalysed.Load())
+	p.MovementCacheHits, p.MovementCacheMisses = pc.movementCache.stats()
+	pc.Observer.Progress(p)
+}
+
+/*
+getGroupMovementList returns the moves of the groups of pieces that can move, not only the groups that follow
+from the algorithm of Bill Cutler. A group grows from a single piece: it takes along the pieces it hits until it
+can move, and again for every larger distance. A group that slides several units is one move, so the breadth
+first search in Solve finds the separation with the fewest moves, the way BurrTools counts them.
+Expects the raw distances of fillMovementMatrix in the cutler matrix.
+*/
+func (sc *SolverCache_t) getGroupMovementList(node *node_t) []*node_t {
+	nPieces := len(node.root.rootDetails.pieceList)
+	nDims := 3 * nPieces
+	m := sc.cutlerMatrix
+	sc.movesList = sc.movesList[:0]
+	inGroup := make([]bool, nPieces)
+	grown := make([]int, 0, nPieces)
+	pieces := make([]burrutils.Id_t, 0, nPieces)
+	key := make([]byte, 0, 2*nPieces)
+
+	for dim := 0; dim < 3; dim++ {
+		// the groups that moved along dim, with the direction of the move
+		seen := make(map[string]bool)
+		for _, sign := range [2]burrutils.Distance_t{1, -1} {
+			// distance returns how far piece i can move in the direction, before it hits piece j
+			distance := func(i, j int) burrutils.Distance_t {
+				if sign > 0 {
+					return m[j*nDims+i*3+dim]
+				}
+				return m[i*nDims+j*3+dim]
+			}
+			for k := 0; k < nPieces; k++ {
+				clear(inGroup)
+				inGroup[k] = true
+				grown = append(grown[:0], k)
+				for step := burrutils.Distance_t(1); ; {
+					// take along the pieces that the group hits before it moved step units
+					for n := 0; n < len(grown); n++ {
+						for j := 0; j < nPieces; j++ {
+							if !inGroup[j] && distance(grown[n], j) < step {
+								inGroup[j] = true
+								grown = append(grown, j)
+							}
+						}
+					}
+					if len(grown) == nPieces {
+						break
+					}
+					vMove := maxDistance
+					for _, i := range grown {
+						for j := 0; j < nPieces; j++ {
+							if !inGroup[j] {
+								vMove = min(vMove, distance(i, j))
+							}
+						}
+					}
+					// a group with more than half of the pieces moves as the other pieces
+					// moving in the opposite direction
+					moving, direction := len(grown) <= nPieces/2, sign
+					if !moving {
+						direction = -sign
+					}
+					pieces, key = pieces[:0], append(key[:0], byte(direction+1))
+					for i := 0; i < nPieces; i++ {
+						if inGroup[i] == moving {
+							pieces = append(pieces, burrutils.Id_t(i))
+							key = append(key, byte(i), byte(i>>8))
+						}
+					}
+					if seen[string(key)] {
+						// the group grows the same way it did before
+						break
+					}
+					seen[string(key)] = true
+					offset := maxVal_t{0, 0, 0}
+					if vMove >= maxDistance {
+						offset[dim] = direction * maxDistance
+						sc.movesList = append(sc.movesList, sc.nodecache.NewNodeChild(node, pieces, offset, true))
+						return sc.movesList
+					}
+					for s := burrutils.Distance_t(1); s <= vMove; s++ {
+						offset[dim] = direction * s
+						sc.movesList = append(sc.movesList, sc.nodecache.NewNodeChild(node, pieces, offset, false))
+					}
+					step = vMove + 1
+				}
+			}
+		}
+	}
+	return sc.movesList
 }
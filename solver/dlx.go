@@ -11,7 +11,8 @@ type row_t []int
 type annotation_t struct {
 	partID     burrutils.Id_t
 	instanceID burrutils.Id_t
-	shapeID    burrutils.Id_t
+	shapeID    burrutils.Id_t // the piece, firstID + instanceID
+	firstID    burrutils.Id_t // the shapeID of the first instance of the part
 	rotation   burrutils.Id_t
 	hotspot    [3]burrutils.Distance_t
 	offset     [3]burrutils.Distance_t
@@ -20,6 +21,7 @@ type annotation_t struct {
 type matrixEntry_t struct {
 	row        *row_t
 	annotation *annotation_t
+	reduced    bool // the row places a symmetry breaker with more instances in a reduced rotation
 }
 
 type matrix_t []*matrixEntry_t
@@ -47,115 +49,33 @@ func (sc ProblemCache_t) calcDLXrow(shapeid, rotid burrutils.Id_t, x, y, z burru
 	// Get the worldmap of the resultvoxel
 	r := sc.GetResultInstance()
 	resmap := *(r.GetWorldmap())
-	// Get a clone of the worldmap of the shape and translate it
-	piecemap := sc.GetShapeInstance(shapeid, rotid).GetWorldmap().Clone()
-	piecemap.Translate(x, y, z)
+	// Get the worldmap of the shape, its positions are translated while we go
+	piecemap := sc.GetShapeInstance(shapeid, rotid).GetWorldmap()
 	lookupMap := sc.dlxLookupmap
+	problem := sc.GetProblem()
 	// filled and vari now contain the positions of the filled and variable pixels of the puzzle
 	// We do this now for every call, we can speed things up if we do this once when we create the
 	// full DLX matrix at time of "solve"
-	for key := range piecemap {
+	for key := 0; key < piecemap.Size(); key++ {
 		// check if we can place the pixels of piecmap into resmap
-		if !resmap.Has(piecemap.Position(key)) {
+		p := piecemap.Position(key)
+		p[0], p[1], p[2] = p[0]+x, p[1]+y, p[2]+z
+		ridx := resmap.Find(p)
+		if ridx < 0 {
 			// if we can not place a pixel, bail out and return nil (no DLXmap to create)
 			return nil
 		}
+		// the color of the pixel has to fit the color of the result
+		if !problem.PlacementAllowed(piecemap.Color(key), resmap.Color(ridx)) {
+			return nil
+		}
 		// The DLX algorithm in go is different, we just need to pass the positions of the "1"s
-		result = append(result, lookupMap[piecemap.Position(key)])
+		result = append(result, lookupMap[p])
 	}
 	slices.Sort(result)
 	return
 }
 
-/*
-func (sc *ProblemCache_t) calcDLXmatrix() *matrix_t {
-	matrix := make(matrix_t, 0)
-	// calculate rotaionLists
-	rotationLists := make([]int, sc.idSize)
-	r := sc.GetResultInstance()
-	rbb := r.GetBoundingbox()
-	rsymgroupID := r.voxel.CalcSelfSymmetries()
-	// Determine symmetry breaker
-	breakerID := -1
-	voxelSize := uint8(0)
-	breakerReduction := 0
-	reducedRotlist := 0
-	shapeDefs := sc.puzzle.Problems[sc.problemIndex].Shapes
-	for idx, shape := range shapeDefs {
-		voxel := sc.puzzle.Shapes[shape.Id]
-		voxelSize = shape.GetPartMinimum()
-		symgroupID := voxel.CalcSelfSymmetries()
-		rotlist := burrutils.RotationsToCheck[symgroupID]
-		rotationLists[idx] = rotlist // no need to copy, this is just an integer bitmap
-		reducedRotlist = burrutils.ReduceRotations(rsymgroupID, rotlist)
-		rotlistLength := burrutils.BitmapSize(rotlist)
-		reducedRotlistLength := burrutils.BitmapSize(reducedRotlist)
-
-		if (rotlistLength - reducedRotlistLength) >= breakerReduction {
-			if (rotlistLength - reducedRotlistLength) == breakerReduction {
-				if voxelSize == 1 {
-					breakerID = idx
-				}
-			} else {
-				breakerID = idx
-				breakerReduction = rotlistLength - reducedRotlistLength
-			}
-		}
-	}
-
-	// caclulate the reduced rotationlist
-	if breakerID >= 0 {
-		reducedRotlist = burrutils.ReduceRotations(rsymgroupID, rotationLists[breakerID])
-		rotationLists[breakerID] = reducedRotlist
-	}
-	// now start building the DLX matrix, keeping track of duplicate voxels
-	// First we need to calculate the rows for every voxel, because the additional
-	// constraint columns will depend on the number of rows per voxel.
-	// We also need to keep track if the source rotation has been reduced or not
-	rowMap := make(map[burrutils.Id_t][]row_t)
-	annotationMap := make(map[burrutils.Id_t][]annotation_t)
-	var row row_t
-	for i := range shapeDefs {
-		idx := burrutils.Id_t(i)
-		//
-		rotlist := burrutils.HashToRotations(rotationLists[idx])
-		rowMap[idx] = make([]row_t, 0)
-		annotationMap[idx] = make([]annotation_t, 0)
-		for _, rotidx := range rotlist {
-			rotatedInstance := sc.GetShapeInstance(idx, rotidx)
-			pbb := rotatedInstance.GetBoundingbox()
-			for x := rbb.Min[0] - pbb.Min[0]; x <= rbb.Max[0]-pbb.Max[0]; x++ {
-				for y := rbb.Min[1] - pbb.Min[1]; y <= rbb.Max[1]-pbb.Max[1]; y++ {
-					for z := rbb.Min[2] - pbb.Min[2]; z <= rbb.Max[2]-pbb.Max[2]; z++ {
-						row = sc.calcDLXrow(idx, rotidx, x, y, z)
-						if len(row) > 0 {
-							rowMap[idx] = append(rowMap[idx], row)
-							annotationMap[idx] = append(annotationMap[idx], annotation_t{burrutils.Id_t(idx), rotidx, rotatedInstance.hotspot, [3]burrutils.Distance_t{x, y, z}})
-						}
-					}
-				}
-			}
-		}
-		// Now we have all the rows for the referenced voxels.
-		// The index in rowMap is NOT the voxelid, but the id of the Shapedefinition in the problem.
-	}
-
-	// construct the matrix
-	for i := range shapeDefs {
-		idx := burrutils.Id_t(i)
-		nRows := len(rowMap[idx])
-		for n := 0; n < nRows; n++ {
-			newrow := rowMap[idx][n]
-			newannotation := annotationMap[idx][n]
-			matrix = append(matrix, &matrixEntry_t{&newrow, &newannotation})
-		}
-
-	}
-
-	return &matrix
-}
-*/
-
 func (sc *ProblemCache_t) calcDLXmatrix() *matrix_t {
 	matrix := make(matrix_t, 0)
 	// calculate rotaionLists
@@ -174,7 +94,7 @@ func (sc *ProblemCache_t) calcDLXmatrix() *matrix_t {
 	// sc.puzzle.Shapes[Id] -> voxel corresponding to Id
 	for idx, shape := range shapeDefs {
 		voxel := sc.puzzle.Shapes[shape.Id]
-		voxelSize = int(shape.Count)
+		voxelSize = int(shape.GetPartMaximum())
 		symgroupID := voxel.CalcSelfSymmetries()
 		rotlist := burrutils.RotationsToCheck[symgroupID]
 		rotationLists[idx] = rotlist // no need to copy, this is just an integer bitmap
@@ -182,6 +102,10 @@ func (sc *ProblemCache_t) calcDLXmatrix() *matrix_t {
 		rotlistLength := burrutils.BitmapSize(rotlist)
 		reducedRotlistLength := burrutils.BitmapSize(reducedRotlist)
 
+		if shape.GetPartMinimum() == 0 && voxelSize > 1 {
+			// a breaker with more instances needs one of them in every assembly
+			continue
+		}
 		if (rotlistLength - reducedRotlistLength) >= breakerReduction {
 			if (rotlistLength - reducedRotlistLength) == breakerReduction {
 				if voxelSize < breakerSize {
@@ -199,102 +123,86 @@ func (sc *ProblemCache_t) calcDLXmatrix() *matrix_t {
 	if breakerID >= 0 {
 		reducedRotlist = burrutils.ReduceRotations(rsymgroupID, rotationLists[breakerID])
 	}
-	// now start building the DLX matrix, keeping track of duplicate voxels
-	// First we need to calculate the rows for every voxel, because the additional
-	// constraint columns will depend on the number of rows per voxel.
-	// We also need to keep track if the source rotation has been reduced or not
-	rowMap := make(map[burrutils.Id_t][]row_t)
-	annotationMap := make(map[burrutils.Id_t][]annotation_t)
-	breakerIsReduced := make(map[int]bool)
+	// now build the DLX matrix, with one row for every placement of every part.
+	// The instances of a part share the rows, the Searchconfig bounds the column of the part with its range.
+	// If the symmetry breaker has one instance, it only gets the reduced rotations. Otherwise the rows
+	// with a reduced rotation are marked, newSearchconfig limits the first instance to them.
 	psid := burrutils.Id_t(0)
-	var row row_t
 	for i, shape := range shapeDefs {
 		idx := burrutils.Id_t(i)
+		nCopies := int(shape.GetPartMaximum())
 		rotlist := burrutils.HashToRotations(rotationLists[idx])
-		rowMap[idx] = make([]row_t, 0)
-		annotationMap[idx] = make([]annotation_t, 0)
 		for _, rotidx := range rotlist {
+			reduced := i == breakerID && reducedRotlist&(1<<rotidx) > 0
+			if nCopies == 0 || (i == breakerID && nCopies == 1 && !reduced) {
+				continue
+			}
 			rotatedInstance := sc.GetShapeInstance(psid, rotidx)
 			pbb := rotatedInstance.GetBoundingbox()
 			for x := rbb.Min[0] - pbb.Min[0]; x <= rbb.Max[0]-pbb.Max[0]; x++ {
 				for y := rbb.Min[1] - pbb.Min[1]; y <= rbb.Max[1]-pbb.Max[1]; y++ {
 					for z := rbb.Min[2] - pbb.Min[2]; z <= rbb.Max[2]-pbb.Max[2]; z++ {
-						row = sc.calcDLXrow(psid, rotidx, x, y, z)
+						row := sc.calcDLXrow(psid, rotidx, x, y, z)
 						if len(row) > 0 {
-							rowMap[idx] = append(rowMap[idx], row)
-							annotationMap[idx] = append(annotationMap[idx], annotation_t{burrutils.Id_t(idx), 0, 0, rotidx, rotatedInstance.hotspot, [3]burrutils.Distance_t{x, y, z}})
-							// if this is the symmetry breaker, track a mapping of rownumber -> isReduced
-							if (i == breakerID) && (reducedRotlist&(1<<rotidx) > 0) {
-								breakerIsReduced[len(rowMap[idx])-1] = true
-							}
+							annotation := annotation_t{idx, 0, psid, psid, rotidx, rotatedInstance.hotspot, [3]burrutils.Distance_t{x, y, z}}
+							matrix = append(matrix, &matrixEntry_t{&row, &annotation, reduced && nCopies > 1})
 						}
 					}
 				}
 			}
 		}
-		// Now we have all the rows for the referenced voxels.
-		// The index in rowMap is NOT the voxelid, but the id of the Shapedefinition in the problem.
-		psid += burrutils.Id_t(shape.Count)
+		// the shapeID of the first instance, the Searchconfig numbers the instances of every assembly
+		psid += burrutils.Id_t(nCopies)
 	}
 
-	// We can now calculate the additional constraints and generate the matrix entries
-	curRowsize := sc.GetNumPrimary() + sc.GetNumSecondary()
-	psid = 0
-	for i, shape := range shapeDefs {
-		idx := burrutils.Id_t(i)
-		nRows := len(rowMap[idx])
-		nCopies := int(shape.Count)
-		for c := 0; c < nCopies; c++ {
-			var delta int
-			for n := 0; n < nRows; n++ {
-				delta = 0
-				// clone the source row
-				newrow := row_t{}
-				newrow = append(newrow, rowMap[idx][n]...)
-				// create preamble (permutation limiter)
-				if c > 0 {
-					for j := 0; j < nRows-1-n; j++ {
-						newrow = append(newrow, curRowsize+n+j)
-					}
-					delta = nRows - 1
-				}
-				// Add the column of 1's (piece identity)
-				// For puzzles using a "min" value of occurences, this column should move to the primary columns, not the secondary
-				newrow = append(newrow, curRowsize+delta)
-				delta += 1
-				// Add the [I] matrix (only if there are multiple copies and this is not the last one)
-				if c < nCopies-1 {
-					newrow = append(newrow, curRowsize+delta+n)
-				}
-				newannotation := annotationMap[idx][n]
-				newannotation.instanceID = burrutils.Id_t(c)
-				newannotation.shapeID = psid
-				// we now have the row defined, and need to add it to the final matrix
-				// KG : If this is the symmetry breaker, we still need to filter on the reduced rotations
+	return &matrix
+}
 
-				if c > 0 {
-					matrix = append(matrix, &matrixEntry_t{&newrow, &newannotation})
-				} else {
-					if breakerID != i {
-						matrix = append(matrix, &matrixEntry_t{&newrow, &newannotation})
-					} else {
-						if breakerIsReduced[n] {
-							matrix = append(matrix, &matrixEntry_t{&newrow, &newannotation})
-						} else {
-							psid += 0
-						}
-					}
+/*
+newSearchconfig returns a Searchconfig_t with the rows of the DLX matrix.
+The first instance of a symmetry breaker with more instances uses a reduced rotation, and the other instances
+use the rows that follow its row. The first instance gets its own copy of the reduced rows, that cover a column
+that every assembly covers once. Every row of the other instances covers a column of its own, the rows of the
+first instance cover the ones of the rows before them.
+*/
+func (sc *ProblemCache_t) newSearchconfig() Searchconfig_t {
+	searchConfig := NewSearchconfig(*sc)
+	searchConfig.MaxSteps = sc.MaxSearchSteps
+	searchConfig.Observer = sc.Observer
+	searchConfig.Workers = sc.AssemblyWorkers
+	searchConfig.Steal = sc.AssemblySteal
+	matrix := *sc.getDLXmatrix()
+	breakerID := burrutils.Id_t(0)
+	hasBreaker := false
+	for _, entry := range matrix {
+		if entry.reduced {
+			breakerID, hasBreaker = entry.annotation.partID, true
+			break
+		}
+	}
+	// the rows of the breaker, and the column of every one of them
+	var breakerRows, limiter []int
+	firstCol := -1
+	for n, entry := range matrix {
+		if !hasBreaker || entry.annotation.partID != breakerID {
+			searchConfig.AddRow(*entry.row, *entry.annotation)
+			continue
+		}
+		if firstCol < 0 {
+			firstCol = searchConfig.AddColumn(1, 1)
+			for k := n; k < len(matrix) && matrix[k].annotation.partID == breakerID; k++ {
+				breakerRows = append(breakerRows, k)
+				limiter = append(limiter, searchConfig.AddColumn(0, 1))
+			}
+			for k, r := range breakerRows {
+				if matrix[r].reduced {
+					searchConfig.AddRow(append(append(slices.Clip(*matrix[r].row), firstCol), limiter[:k]...), *matrix[r].annotation)
 				}
 			}
-			psid += 1
-			curRowsize += delta
 		}
+		searchConfig.AddRow(append(slices.Clip(*entry.row), limiter[n-breakerRows[0]]), *entry.annotation)
 	}
-
-	// KG: quick and dirty patch of the secondary column size in the cache
-	sc.numSecondary = curRowsize - sc.GetNumPrimary()
-
-	return &matrix
+	return searchConfig
 }
 
 func (sc *ProblemCache_t) getDLXmatrix() *matrix_t {
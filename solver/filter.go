@@ -0,0 +1,156 @@
+package solver
+
+import (
+	burrutils "github.com/kgeusens/go/burr-data/burrutils"
+)
+
+/*
+assemblyFilter_t recognizes assemblies that are a duplicate of an assembly the assembler found before:
+the same assembly after a symmetry of the result, or after a mirror symmetry with every part replaced by
+its mirror partner. Identical pieces can be swapped, because an assembly is identified by the part that
+fills every voxel of the result and the voxels that belong to the same piece.
+*/
+type assemblyFilter_t struct {
+	pc         *ProblemCache_t
+	partner    []burrutils.Id_t // the mirror partner of every part
+	symmetries []symmetry_t     // the symmetries of the result, except the identity
+	seen       map[string]bool  // the canonical keys of the assemblies that were kept
+	removed    int
+}
+
+/*
+symmetry_t is a symmetry of the result, target tells where every voxel of the result goes
+*/
+type symmetry_t struct {
+	target []int
+	mirror bool
+}
+
+/*
+newAssemblyFilter returns a filter for the symmetries of the result, and its mirror symmetries if mirrors is set
+and every part has a mirror partner with the same range. It returns nil if the result has no symmetries to filter.
+*/
+func (pc *ProblemCache_t) newAssemblyFilter(mirrors bool) *assemblyFilter_t {
+	af := &assemblyFilter_t{pc: pc, seen: make(map[string]bool)}
+	resmap := *pc.resultInstance.GetWorldmap()
+	// symmetry adds the symmetry t if it maps the result onto itself
+	symmetry := func(t burrutils.Id_t) {
+		transformed := resmap.Clone()
+		transformed.Transform(t)
+		transformed.Normalize()
+		if !transformed.Equal(resmap) {
+			return
+		}
+		target := make([]int, len(pc.dlxLookupmap))
+		for key := 0; key < resmap.Size(); key++ {
+			target[pc.dlxLookupmap[resmap.Position(key)]] = pc.dlxLookupmap[transformed.Position(key)]
+		}
+		af.symmetries = append(af.symmetries, symmetry_t{target, burrutils.IsMirror(t)})
+	}
+	if symgroupID := pc.resultVoxel.CalcSelfSymmetries(); symgroupID >= 0 {
+		for _, rot := range burrutils.HashToRotations(burrutils.SymmetryGroups[symgroupID]) {
+			if rot != 0 {
+				symmetry(rot)
+			}
+		}
+	}
+	if mirrors {
+		if af.partner = pc.mirrorPartners(); af.partner != nil {
+			for t := burrutils.Id_t(burrutils.NumRotations); t < burrutils.NumTransformations; t++ {
+				symmetry(t)
+			}
+		}
+	}
+	if len(af.symmetries) == 0 {
+		return nil
+	}
+	return af
+}
+
+/*
+mirrorPartners returns the mirror partner of every part, or nil if a part has no mirror partner with the same range
+*/
+func (pc *ProblemCache_t) mirrorPartners() []burrutils.Id_t {
+	problem := pc.GetProblem()
+	var partners []burrutils.Id_t
+	for i, part := range problem.Shapes {
+		partner := -1
+		for j, other := range problem.Shapes {
+			if problem.GetPartMinimum(burrutils.Id_t(i)) != problem.GetPartMinimum(burrutils.Id_t(j)) ||
+				problem.GetPartMaximum(burrutils.Id_t(i)) != problem.GetPartMaximum(burrutils.Id_t(j)) {
+				continue
+			}
+			if pc.puzzle.Shapes[part.Id].TransformsTo(&pc.puzzle.Shapes[other.Id], true) >= 0 {
+				partner = j
+				break
+			}
+		}
+		if partner < 0 {
+			return nil
+		}
+		partners = append(partners, burrutils.Id_t(partner))
+	}
+	return partners
+}
+
+/*
+isDuplicate returns true if the assembly is a duplicate of an assembly that was kept before,
+otherwise the assembly is kept.
+*/
+func (af *assemblyFilter_t) isDuplicate(assembly Assembly_t) bool {
+	// the voxels of the result that every piece fills
+	voxels := make([][]int, len(assembly))
+	for k, a := range assembly {
+		piecemap := *af.pc.GetShapeInstance(a.shapeID, a.rotation).GetWorldmap()
+		for key := 0; key < piecemap.Size(); key++ {
+			p := piecemap.Position(key)
+			voxels[k] = append(voxels[k], af.pc.dlxLookupmap[[3]burrutils.Distance_t{p[0] + a.offset[0], p[1] + a.offset[1], p[2] + a.offset[2]}])
+		}
+	}
+	cells := make([]burrutils.Id_t, 2*len(af.pc.dlxLookupmap))
+	// assemblyKey labels every voxel with its part and the lowest voxel of its piece, after the symmetry
+	assemblyKey := func(sym *symmetry_t) string {
+		clear(cells)
+		for k, a := range assembly {
+			part := a.partID
+			if sym != nil && sym.mirror {
+				part = af.partner[part]
+			}
+			label := len(cells)
+			for _, v := range voxels[k] {
+				if sym != nil {
+					v = sym.target[v]
+				}
+				label = min(label, v)
+			}
+			for _, v := range voxels[k] {
+				if sym != nil {
+					v = sym.target[v]
+				}
+				cells[2*v], cells[2*v+1] = part+1, burrutils.Id_t(label)
+			}
+		}
+		return partsKey(cells)
+	}
+	// the canonical key is the smallest key of all the symmetric assemblies
+	canonical := assemblyKey(nil)
+	for i := range af.symmetries {
+		if key := assemblyKey(&af.symmetries[i]); key < canonical {
+			canonical = key
+		}
+	}
+	if af.seen[canonical] {
+		af.removed++
+		return true
+	}
+	af.seen[canonical] = true
+	return false
+}
+
+func partsKey(parts []burrutils.Id_t) string {
+	key := make([]byte, 0, 2*len(parts))
+	for _, p := range parts {
+		key = append(key, byte(p), byte(p>>8))
+	}
+	return string(key)
+}
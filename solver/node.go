@@ -1,6 +1,7 @@
 package solver
 
 import (
+	"slices"
 	"strconv"
 	"strings"
 
@@ -11,14 +12,20 @@ import (
 const maxShapes = 30
 
 /*
-Limitation:
-The problem we are solving can not have more than 30 pieces.
-That is because we needed a super fast "GetID" solution for the nodes that is "comparable"
+Nodes of assemblies with up to maxShapes pieces use id_t as their identity.
+We needed a super fast "GetID" solution for the nodes that is "comparable"
 and an array of fixed length seemed to be the fastest. However, the length of the array
-has a considerable impace on the performance.
+has a considerable impace on the performance, so larger assemblies use GetKey instead.
 */
 type id_t [3 * maxShapes]burrutils.Distance_t
 
+/*
+nodeKey_t is the identity of a node in the closed cache of the solver
+*/
+type nodeKey_t interface {
+	id_t | string
+}
+
 type node_t struct {
 	parent          *node_t
 	root            *node_t
@@ -28,6 +35,8 @@ type node_t struct {
 	moveDirection   [3]burrutils.Distance_t
 	id              id_t
 	idValid         bool
+	key             string
+	keyValid        bool
 	rootDetails     *rootDetails_t
 }
 
@@ -38,6 +47,10 @@ type rootDetails_t struct {
 	separation   *xmpuzzle.Separation
 }
 
+/*
+GetId returns the positions of the pieces relative to the first piece,
+only for nodes with up to maxShapes pieces.
+*/
 func (node *node_t) GetId() id_t {
 	if !node.idValid {
 		nPieces := len(node.root.rootDetails.pieceList)
@@ -52,7 +65,52 @@ func (node *node_t) GetId() id_t {
 	return node.id
 }
 
-func (node *node_t) RecordSeparationInRoot() {
+/*
+GetKey returns the same identity as GetId, for any number of pieces
+*/
+func (node *node_t) GetKey() string {
+	if !node.keyValid {
+		nPieces := len(node.root.rootDetails.pieceList)
+		offsetList := node.offsetList
+		key := make([]byte, 0, 6*nPieces)
+		for idx := 0; idx < nPieces; idx++ {
+			for dim := 0; dim < 3; dim++ {
+				d := uint16(offsetList[idx*3+dim] - offsetList[dim])
+				key = append(key, byte(d), byte(d>>8))
+			}
+		}
+		node.key = string(key)
+		node.keyValid = true
+	}
+	return node.key
+}
+
+// removalDistance is how far BurrTools moves the pieces that are removed in a separation
+const removalDistance = 20000
+
+/*
+position returns the position of piece idx in the node in dimension dim, the way BurrTools writes it:
+relative to origin (the hotspot of the result), and removed pieces are moved removalDistance away.
+*/
+func (node *node_t) position(idx, dim int, origin [3]burrutils.Distance_t) int {
+	pos := int(node.offsetList[idx*3+dim]) + int(node.root.rootDetails.hotspotList[idx*3+dim]) - int(origin[dim])
+	if node.isSeparation && node.moveDirection[dim] != 0 && slices.Contains(node.movingPieceList, burrutils.Id_t(idx)) {
+		// undo the move over maxDistance and remove the BurrTools way
+		pos -= int(node.moveDirection[dim])
+		if node.moveDirection[dim] > 0 {
+			pos += removalDistance
+		} else {
+			pos -= removalDistance
+		}
+	}
+	return pos
+}
+
+/*
+RecordSeparationInRoot records the pieces of the root, and the states from the root down to
+this node (a separation), in the separation of the root.
+*/
+func (node *node_t) RecordSeparationInRoot(origin [3]burrutils.Distance_t) {
 	// set the values for pieces
 	sep := node.root.rootDetails.separation
 	sep.Pieces.Count = len(node.root.rootDetails.pieceList)
@@ -62,31 +120,27 @@ func (node *node_t) RecordSeparationInRoot() {
 	}
 	sep.Pieces.Text = strings.Join(str, " ")
 	// add the states by walking back up to the root
-	keepWalking := true
-	n := node
-	for keepWalking {
+	sep.State = sep.State[:0]
+	for n := node; n != nil; n = n.parent {
 		state := xmpuzzle.State{}
 		dx := []string{}
 		dy := []string{}
 		dz := []string{}
 		for i := 0; i < sep.Pieces.Count; i++ {
-			dx = append(dx, strconv.Itoa(int(n.offsetList[i*3])))
-			dy = append(dy, strconv.Itoa(int(n.offsetList[i*3+1])))
-			dz = append(dz, strconv.Itoa(int(n.offsetList[i*3+2])))
+			dx = append(dx, strconv.Itoa(n.position(i, 0, origin)))
+			dy = append(dy, strconv.Itoa(n.position(i, 1, origin)))
+			dz = append(dz, strconv.Itoa(n.position(i, 2, origin)))
 		}
 		state.DX.Text = strings.Join(dx, " ")
 		state.DY.Text = strings.Join(dy, " ")
 		state.DZ.Text = strings.Join(dz, " ")
 		sep.State = append(sep.State, state)
-		if n != n.root {
-			n = n.root
-		} else {
-			keepWalking = false
+		if n == n.root {
+			break
 		}
 	}
 	// the states are in reverse order now, we should correct this
 	for i := 0; i < len(sep.State)/2; i++ {
 		sep.State[i], sep.State[len(sep.State)-1-i] = sep.State[len(sep.State)-1-i], sep.State[i]
 	}
-	// now record this in the rootdetails of the root
 }
@@ -36,6 +36,8 @@ func (nc *NodeCache_t) release(node *node_t) {
 	node.moveDirection[1] = 0
 	node.moveDirection[2] = 0
 	node.idValid = false
+	node.key = ""
+	node.keyValid = false
 	node.rootDetails = nil
 	nc.freeList = append(nc.freeList, node)
 }
@@ -70,12 +72,14 @@ func (nc *NodeCache_t) NewNodeChild(parent *node_t, movingPieceList []burrutils.
 	return
 }
 
-func (nc *NodeCache_t) NewNodeFromAssembly(assembly assembly_t) *node_t {
+func (nc *NodeCache_t) NewNodeFromAssembly(assembly Assembly_t) *node_t {
 	root := nc.request()
 	root.root = root
 	root.rootDetails = &rootDetails_t{[]burrutils.Id_t{}, []burrutils.Id_t{}, []burrutils.Distance_t{}, &xmpuzzle.Separation{}}
-	// loop over the shape annotations
-	for _, v := range assembly {
+	// loop over the shape annotations, in the order of the pieces of the problem
+	sorted := slices.Clone(assembly)
+	slices.SortFunc(sorted, func(a, b *annotation_t) int { return int(a.shapeID) - int(b.shapeID) })
+	for _, v := range sorted {
 		root.rootDetails.pieceList = append(root.rootDetails.pieceList, v.shapeID)
 		root.rootDetails.rotationList = append(root.rootDetails.rotationList, v.rotation)
 		root.rootDetails.hotspotList = append(root.rootDetails.hotspotList, v.hotspot[0], v.hotspot[1], v.hotspot[2])
@@ -84,64 +88,50 @@ func (nc *NodeCache_t) NewNodeFromAssembly(assembly assembly_t) *node_t {
 	return root
 }
 
+/*
+Separate creates the roots of the sub problems after the separation in node:
+the pieces that are removed, and the pieces that are left. A group of a single piece
+is not a problem anymore and gets no root. The separations of the sub problems are
+added to the separation of the root of node, the removed pieces first like BurrTools does.
+*/
 func (nc *NodeCache_t) Separate(node *node_t) []*node_t {
 	newNodes := []*node_t{}
 	if node.isSeparation {
-		// only add a new rootNode if it will contain more than 1 piece
+		sep := node.root.rootDetails.separation
+		// there are at most 2 sub separations, the pointers to them must remain valid
+		sep.Separations = make([]xmpuzzle.Separation, 0, 2)
 		nPieces := len(node.root.rootDetails.pieceList)
-		if nPieces-len(node.movingPieceList) > 1 {
-			// so at this point, we know we are a separation
-			// movingPieceList and movingDirection tells us what to work with
-			newRoot := nc.request()
-			node.root.rootDetails.separation.Separations = append(node.root.rootDetails.separation.Separations, xmpuzzle.Separation{})
-			newRoot.rootDetails = &rootDetails_t{[]burrutils.Id_t{}, []burrutils.Id_t{}, []burrutils.Distance_t{}, &node.root.rootDetails.separation.Separations[len(node.root.rootDetails.separation.Separations)-1]}
-			newRoot.parent = node
-			newRoot.root = newRoot
-			// only keep the pieces that are not moving. Filter out the moving pieces
-			for i, v := range node.root.rootDetails.pieceList {
-				if !slices.Contains(node.movingPieceList, burrutils.Id_t(i)) {
-					newRoot.rootDetails.pieceList = append(newRoot.rootDetails.pieceList, v)
-				}
-			}
-			for i, v := range node.root.rootDetails.rotationList {
-				if !slices.Contains(node.movingPieceList, burrutils.Id_t(i)) {
-					newRoot.rootDetails.rotationList = append(newRoot.rootDetails.rotationList, v)
-				}
-			}
-			for idx := 0; idx < nPieces; idx++ {
-				if !slices.Contains(node.movingPieceList, burrutils.Id_t(idx)) {
-					newRoot.rootDetails.hotspotList = append(newRoot.rootDetails.hotspotList, node.root.rootDetails.hotspotList[idx*3], node.root.rootDetails.hotspotList[idx*3+1], node.root.rootDetails.hotspotList[idx*3+2])
-					newRoot.offsetList = append(newRoot.offsetList, node.offsetList[idx*3], node.offsetList[idx*3+1], node.offsetList[idx*3+2])
-				}
-			}
-			newNodes = append(newNodes, newRoot)
-		}
 		if len(node.movingPieceList) > 1 {
-			// This is normally the smallest partition
-			newRoot := nc.request()
-			node.root.rootDetails.separation.Separations = append(node.root.rootDetails.separation.Separations, xmpuzzle.Separation{})
-			newRoot.rootDetails = &rootDetails_t{[]burrutils.Id_t{}, []burrutils.Id_t{}, []burrutils.Distance_t{}, &node.root.rootDetails.separation.Separations[len(node.root.rootDetails.separation.Separations)-1]}
-			newRoot.parent = node
-			newRoot.root = newRoot
-			// only keep the pieces that are not moving. Filter out the moving pieces
-			for i, v := range node.root.rootDetails.pieceList {
-				if slices.Contains(node.movingPieceList, burrutils.Id_t(i)) {
-					newRoot.rootDetails.pieceList = append(newRoot.rootDetails.pieceList, v)
-				}
-			}
-			for i, v := range node.root.rootDetails.rotationList {
-				if slices.Contains(node.movingPieceList, burrutils.Id_t(i)) {
-					newRoot.rootDetails.rotationList = append(newRoot.rootDetails.rotationList, v)
-				}
-			}
-			for idx := 0; idx < nPieces; idx++ {
-				if slices.Contains(node.movingPieceList, burrutils.Id_t(idx)) {
-					newRoot.rootDetails.hotspotList = append(newRoot.rootDetails.hotspotList, node.root.rootDetails.hotspotList[idx*3], node.root.rootDetails.hotspotList[idx*3+1], node.root.rootDetails.hotspotList[idx*3+2])
-					newRoot.offsetList = append(newRoot.offsetList, node.offsetList[idx*3], node.offsetList[idx*3+1], node.offsetList[idx*3+2])
-				}
-			}
-			newNodes = append(newNodes, newRoot)
+			// This is normally the smallest partition.
+			// Its positions are the ones from before the separation.
+			newNodes = append(newNodes, nc.newSubRoot(node, node.parent, true, "removed"))
+		}
+		if nPieces-len(node.movingPieceList) > 1 {
+			newNodes = append(newNodes, nc.newSubRoot(node, node, false, "left"))
 		}
 	}
 	return newNodes
 }
+
+/*
+newSubRoot creates the root of a sub problem with the pieces that are moving (or not) in the separation node.
+The positions of the pieces are taken from from.
+*/
+func (nc *NodeCache_t) newSubRoot(node, from *node_t, moving bool, sepType string) *node_t {
+	sep := node.root.rootDetails.separation
+	sep.Separations = append(sep.Separations, xmpuzzle.Separation{Type: sepType})
+	details := node.root.rootDetails
+	newRoot := nc.request()
+	newRoot.rootDetails = &rootDetails_t{[]burrutils.Id_t{}, []burrutils.Id_t{}, []burrutils.Distance_t{}, &sep.Separations[len(sep.Separations)-1]}
+	newRoot.root = newRoot
+	for idx := range details.pieceList {
+		if slices.Contains(node.movingPieceList, burrutils.Id_t(idx)) != moving {
+			continue
+		}
+		newRoot.rootDetails.pieceList = append(newRoot.rootDetails.pieceList, details.pieceList[idx])
+		newRoot.rootDetails.rotationList = append(newRoot.rootDetails.rotationList, details.rotationList[idx])
+		newRoot.rootDetails.hotspotList = append(newRoot.rootDetails.hotspotList, details.hotspotList[idx*3], details.hotspotList[idx*3+1], details.hotspotList[idx*3+2])
+		newRoot.offsetList = append(newRoot.offsetList, from.offsetList[idx*3], from.offsetList[idx*3+1], from.offsetList[idx*3+2])
+	}
+	return newRoot
+}
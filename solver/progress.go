@@ -0,0 +1,57 @@
+package solver
+
+type Phase_t int
+
+const (
+	AssemblyPhase Phase_t = 0 // the assembler is looking for assemblies
+	SolvePhase    Phase_t = 1 // the solver is disassembling an assembly
+)
+
+/*
+Progress_t holds the counters that are passed to an Observer_t.
+Counters that do not apply to the phase are 0.
+*/
+type Progress_t struct {
+	Phase    Phase_t
+	Done     bool // last report of the assembler, or of the assembly that is solved
+	Assembly int  // the assembly that is solved
+
+	Nodes int // DLX nodes visited by the assembler, or nodes analysed by the solver for this assembly
+	Level int // current level of the DLX search, or of the breadth first search of the solver
+
+	AssembliesFound    int // assemblies found by the assembler
+	AssembliesAnalysed int // assemblies that Solve finished, for the whole problem
+	Separations        int // separations found for this assembly
+	ClosedCacheSize    int // nodes in the closed cache for this assembly
+
+	MovementCacheHits   uint64 // for the whole problem
+	MovementCacheMisses uint64
+}
+
+/*
+MovementCacheHitRate returns the fraction of the lookups in the movement cache that were a hit
+*/
+func (p Progress_t) MovementCacheHitRate() float64 {
+	total := p.MovementCacheHits + p.MovementCacheMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(p.MovementCacheHits) / float64(total)
+}
+
+/*
+Observer_t is called by the assembler and the solver every few thousand steps, and when they finish.
+With SolveAll it is called from several goroutines at the same time.
+*/
+type Observer_t interface {
+	Progress(p Progress_t)
+}
+
+/*
+ObserverFunc_t turns a function into an Observer_t
+*/
+type ObserverFunc_t func(p Progress_t)
+
+func (f ObserverFunc_t) Progress(p Progress_t) {
+	f(p)
+}
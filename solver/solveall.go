@@ -0,0 +1,161 @@
+package solver
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	xmpuzzle "github.com/kgeusens/go/burr-data/xmpuzzle"
+)
+
+/*
+SolveAll tries to disassemble every assembly of the problem, using workers goroutines.
+When workers is 0 or less, runtime.GOMAXPROCS(0) goroutines are used.
+
+The result has an entry for every assembly in GetAssemblies, the separation tree if it can be disassembled or nil.
+When ctx is cancelled, SolveAll stops, waits for the running goroutines and
+returns the partial result together with ctx.Err().
+Assemblies that need more than MaxSolveNodes nodes are reported as not solved,
+and SolveAll returns ErrBudgetExceeded after it handled all the others.
+It returns ErrTooLarge without solving anything when the problem is too large for the solver.
+*/
+func (pc *ProblemCache_t) SolveAll(ctx context.Context, workers int) ([]*xmpuzzle.Separation, error) {
+	solved := make([]*xmpuzzle.Separation, len(pc.GetAssemblies()))
+	err := pc.solveEach(ctx, workers, func(i int, sep *xmpuzzle.Separation) {
+		solved[i] = sep
+	})
+	return solved, err
+}
+
+/*
+solveEach disassembles the assemblies like SolveAll, and passes the separation tree of every assembly to f
+as soon as it is done, nil if it can not be disassembled. The calls to f do not overlap.
+*/
+func (pc *ProblemCache_t) solveEach(ctx context.Context, workers int, f func(i int, sep *xmpuzzle.Separation)) error {
+	if pc.worldMax == 0 {
+		return ErrTooLarge
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	assemblies := pc.GetAssemblies()
+
+	jobs := make(chan int)
+	var budgetErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sep, err := pc.SolveContext(ctx, assemblies[i], i)
+				if err != nil {
+					// a partial separation tree is no solution
+					sep = nil
+				}
+				mu.Lock()
+				if errors.Is(err, ErrBudgetExceeded) {
+					budgetErr = err
+				}
+				f(i, sep)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := range assemblies {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = budgetErr
+	}
+	return err
+}
+
+/*
+SolveProblem assembles the problem, disassembles the assemblies with SolveAll and records the result
+in the problem: a Solution for every assembly that can be disassembled, and the number of assemblies,
+the number of solutions and the time the assembler and the disassembler took.
+When KeepHighestLevel is set, only that many solutions with the highest level are kept while the assemblies are
+disassembled, the highest first, but the number of solutions still counts all of them. The state of the problem is
+set to solved (2) when everything was searched, or to partially solved (1) when the search was cut short.
+It returns ErrTooLarge, or the error of ctx when it is cancelled already, and leaves the problem as it is.
+*/
+func (pc *ProblemCache_t) SolveProblem(ctx context.Context, workers int) error {
+	if pc.worldMax == 0 {
+		return ErrTooLarge
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	assemblies := pc.GetAssemblies()
+	start := time.Now()
+	keep := pc.KeepHighestLevel
+	// the highest level first, and solutions of the same level in the order of their assemblies
+	order := func(a, b xmpuzzle.Solution) int {
+		if c := xmpuzzle.CompareLevel(b.Separation, a.Separation); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.AsmNum, b.AsmNum)
+	}
+	solved := make([]bool, len(assemblies))
+	var kept []xmpuzzle.Solution
+	err := pc.solveEach(ctx, workers, func(i int, sep *xmpuzzle.Separation) {
+		if sep == nil {
+			return
+		}
+		solved[i] = true
+		solution := xmpuzzle.Solution{AsmNum: i, Separation: sep}
+		if keep <= 0 {
+			kept = append(kept, solution)
+			return
+		}
+		if pos, _ := slices.BinarySearchFunc(kept, solution, order); pos < keep {
+			kept = slices.Insert(kept[:min(len(kept), keep-1)], pos, solution)
+		}
+	})
+	if keep <= 0 {
+		slices.SortFunc(kept, func(a, b xmpuzzle.Solution) int { return cmp.Compare(a.AsmNum, b.AsmNum) })
+	}
+	// SolNum numbers the solutions in the order of their assemblies
+	solNum := make([]int, len(assemblies))
+	count := 0
+	for i := range solved {
+		solNum[i] = count
+		if solved[i] {
+			count++
+		}
+	}
+	for k := range kept {
+		kept[k].SolNum = solNum[kept[k].AsmNum]
+		kept[k].Assembly = xmpuzzle.Assembly{Text: pc.EncodeAssembly(assemblies[kept[k].AsmNum])}
+	}
+	pb := pc.GetProblem()
+	pb.Solutions = kept
+	pb.Assemblies = len(assemblies)
+	pb.SolutionCount = count
+	pb.Time = int((pc.assemblyTime + time.Since(start)).Seconds())
+	if err == nil && !pc.AssemblyLimitReached() {
+		pb.State = 2
+	} else {
+		pb.State = 1
+	}
+	return err
+}
@@ -0,0 +1,372 @@
+package solver
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	burrutils "github.com/kgeusens/go/burr-data/burrutils"
+	xmpuzzle "github.com/kgeusens/go/burr-data/xmpuzzle"
+)
+
+/*
+VerifyError_t describes the first step of a solution that is not valid
+*/
+type VerifyError_t struct {
+	Solution   int    // SolNum of the solution
+	Separation string // path of the separation in the tree, like "left.removed", empty for the top separation
+	State      int    // state of the separation, -1 when the assembly is not valid
+	Reason     string
+}
+
+func (e *VerifyError_t) Error() string {
+	where := "assembly"
+	if e.State >= 0 {
+		where = "state " + strconv.Itoa(e.State)
+		if e.Separation != "" {
+			where = e.Separation + " " + where
+		}
+	}
+	return fmt.Sprintf("solver: solution %d: %s: %s", e.Solution, where, e.Reason)
+}
+
+/*
+ParseAssembly parses an assembly in the format of BurrTools, see EncodeAssembly
+*/
+func (pc *ProblemCache_t) ParseAssembly(text string) (Assembly_t, error) {
+	// the part and the copy of the part of every piece
+	partIDs := make([]burrutils.Id_t, 0, pc.idSize)
+	instanceIDs := make([]burrutils.Id_t, 0, pc.idSize)
+	for part, shape := range pc.GetProblem().Shapes {
+		for c := uint8(0); c < shape.GetPartMaximum(); c++ {
+			partIDs = append(partIDs, burrutils.Id_t(part))
+			instanceIDs = append(instanceIDs, burrutils.Id_t(c))
+		}
+	}
+	fields := strings.Fields(text)
+	origin := pc.resultInstance.hotspot
+	assembly := Assembly_t{}
+	for id := 0; id < pc.idSize; id++ {
+		if len(fields) > 0 && fields[0] == "x" {
+			fields = fields[1:]
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("solver: assembly has no placement for piece %d", id)
+		}
+		var v [4]int
+		for i := range v {
+			var err error
+			if v[i], err = strconv.Atoi(fields[i]); err != nil {
+				return nil, fmt.Errorf("solver: assembly piece %d: %w", id, err)
+			}
+		}
+		fields = fields[4:]
+		if v[3] < 0 || v[3] >= 24 {
+			return nil, fmt.Errorf("solver: assembly piece %d has rotation %d", id, v[3])
+		}
+		instance := pc.GetShapeInstance(burrutils.Id_t(id), burrutils.Id_t(v[3]))
+		a := &annotation_t{partID: partIDs[id], instanceID: instanceIDs[id], shapeID: burrutils.Id_t(id), firstID: burrutils.Id_t(id) - instanceIDs[id], rotation: burrutils.Id_t(v[3]), hotspot: instance.hotspot}
+		for dim := 0; dim < 3; dim++ {
+			a.offset[dim] = burrutils.Distance_t(v[dim] + int(origin[dim]) - int(instance.hotspot[dim]))
+		}
+		assembly = append(assembly, a)
+	}
+	if len(fields) > 0 {
+		return nil, fmt.Errorf("solver: assembly has more than %d pieces", pc.idSize)
+	}
+	return assembly, nil
+}
+
+/*
+VerifyAssembly checks that the pieces of the assembly fill the result: every piece is inside the result
+on voxels with a color it can go on, pieces do not overlap, every filled voxel of the result is covered,
+the number of pieces of every part is in its range and there are not more than MaxHoles empty variable voxels.
+*/
+func (pc *ProblemCache_t) VerifyAssembly(assembly Assembly_t) error {
+	problem := pc.GetProblem()
+	resmap := *pc.resultInstance.GetWorldmap()
+	used := make([]int, len(problem.Shapes))
+	occupied := make(map[[3]burrutils.Distance_t]burrutils.Id_t)
+	for _, a := range assembly {
+		used[a.partID]++
+		piecemap := *pc.GetShapeInstance(a.shapeID, a.rotation).GetWorldmap()
+		for key := 0; key < piecemap.Size(); key++ {
+			p := piecemap.Position(key)
+			p[0], p[1], p[2] = p[0]+a.offset[0], p[1]+a.offset[1], p[2]+a.offset[2]
+			ridx := resmap.Find(p)
+			if ridx < 0 {
+				return fmt.Errorf("solver: piece %d is outside the result at %v", a.shapeID, p)
+			}
+			if !problem.PlacementAllowed(piecemap.Color(key), resmap.Color(ridx)) {
+				return fmt.Errorf("solver: piece %d can not go on the color of the result at %v", a.shapeID, p)
+			}
+			if other, ok := occupied[p]; ok {
+				return fmt.Errorf("solver: pieces %d and %d overlap at %v", other, a.shapeID, p)
+			}
+			occupied[p] = a.shapeID
+		}
+	}
+	for part, n := range used {
+		if n < int(problem.GetPartMinimum(burrutils.Id_t(part))) || n > int(problem.GetPartMaximum(burrutils.Id_t(part))) {
+			return fmt.Errorf("solver: part %d is used %d times", part, n)
+		}
+	}
+	holes := 0
+	for key := 0; key < resmap.Size(); key++ {
+		if _, ok := occupied[resmap.Position(key)]; ok {
+			continue
+		}
+		if resmap.Value(key) == 1 {
+			return fmt.Errorf("solver: result voxel %v is empty", resmap.Position(key))
+		}
+		holes++
+	}
+	if problem.MaxHolesDefined() && holes > problem.GetMaxHoles() {
+		return fmt.Errorf("solver: %d holes, only %d allowed", holes, problem.GetMaxHoles())
+	}
+	return nil
+}
+
+/*
+VerifySolution checks the assembly of the solution with VerifyAssembly, and replays the states of its separation:
+every state moves one group of pieces along one axis without collisions, every separation ends by removing
+a group of pieces, and the groups that are left have a separation of their own until all pieces are apart.
+A solution without a separation only gets its assembly checked.
+The error is a *VerifyError_t that tells the first step that is not valid.
+*/
+func (pc *ProblemCache_t) VerifySolution(sol *xmpuzzle.Solution) error {
+	assembly, err := pc.ParseAssembly(sol.Assembly.Text)
+	if err == nil {
+		err = pc.VerifyAssembly(assembly)
+	}
+	if err != nil {
+		return &VerifyError_t{Solution: sol.SolNum, State: -1, Reason: err.Error()}
+	}
+	if sol.Separation == nil {
+		return nil
+	}
+	origin := pc.resultInstance.hotspot
+	pieces := make(map[burrutils.Id_t]*annotation_t)
+	start := make(map[burrutils.Id_t][3]int)
+	for _, a := range assembly {
+		pieces[a.shapeID] = a
+		start[a.shapeID] = [3]int{
+			int(a.offset[0]) + int(a.hotspot[0]) - int(origin[0]),
+			int(a.offset[1]) + int(a.hotspot[1]) - int(origin[1]),
+			int(a.offset[2]) + int(a.hotspot[2]) - int(origin[2]),
+		}
+	}
+	if verr := pc.verifySeparation(sol.Separation, "", pieces, start); verr != nil {
+		verr.Solution = sol.SolNum
+		return verr
+	}
+	return nil
+}
+
+/*
+VerifySolutions verifies every solution of the problem, the result has an error or nil for every solution
+*/
+func (pc *ProblemCache_t) VerifySolutions() []error {
+	solutions := pc.GetProblem().Solutions
+	res := make([]error, len(solutions))
+	for i := range solutions {
+		res[i] = pc.VerifySolution(&solutions[i])
+	}
+	return res
+}
+
+/*
+verifySeparation replays the states of sep, start has the positions of the pieces before the first state
+*/
+func (pc *ProblemCache_t) verifySeparation(sep *xmpuzzle.Separation, path string, pieces map[burrutils.Id_t]*annotation_t, start map[burrutils.Id_t][3]int) *VerifyError_t {
+	fail := func(state int, format string, args ...any) *VerifyError_t {
+		return &VerifyError_t{Separation: path, State: state, Reason: fmt.Sprintf(format, args...)}
+	}
+	var ids []burrutils.Id_t
+	for _, f := range strings.Fields(sep.Pieces.Text) {
+		id, err := strconv.Atoi(f)
+		if err != nil {
+			return fail(0, "%v", err)
+		}
+		if _, ok := start[burrutils.Id_t(id)]; !ok || slices.Contains(ids, burrutils.Id_t(id)) {
+			return fail(0, "piece %d does not belong in the separation", id)
+		}
+		ids = append(ids, burrutils.Id_t(id))
+	}
+	if len(ids) != len(start) {
+		return fail(0, "expected %d pieces, got %d", len(start), len(ids))
+	}
+	if len(sep.State) < 2 {
+		return fail(len(sep.State), "the pieces are not separated")
+	}
+	var prev [][3]int
+	for si := range sep.State {
+		pos, err := sep.State[si].Positions()
+		if err != nil {
+			return fail(si, "%v", err)
+		}
+		if len(pos[0]) != len(ids) {
+			return fail(si, "expected %d positions, got %d", len(ids), len(pos[0]))
+		}
+		cur := make([][3]int, len(ids))
+		for i := range ids {
+			cur[i] = [3]int{pos[0][i], pos[1][i], pos[2][i]}
+		}
+		if si == 0 {
+			for i, id := range ids {
+				if cur[i] != start[id] {
+					return fail(si, "piece %d is at %v instead of %v", id, cur[i], start[id])
+				}
+			}
+			prev = cur
+			continue
+		}
+		moving, dim, sign, distance, err := stateMove(prev, cur)
+		if err != nil {
+			return fail(si, "%v", err)
+		}
+		removed := distance >= xmpuzzle.RemovedDistance
+		last := si == len(sep.State)-1
+		if removed && !last {
+			return fail(si, "pieces are removed before the last state")
+		}
+		if !removed && last {
+			return fail(si, "the last state does not remove any pieces")
+		}
+		if a, b, hit := pc.collision(ids, pieces, prev, moving, dim, sign, distance); hit {
+			return fail(si, "piece %d hits piece %d", a, b)
+		}
+		if removed {
+			return pc.verifySubSeparations(sep, path, si, ids, pieces, prev, moving)
+		}
+		prev = cur
+	}
+	return nil
+}
+
+/*
+verifySubSeparations checks that the groups of pieces after the removal in state si have a valid separation,
+pos has the positions before the removal
+*/
+func (pc *ProblemCache_t) verifySubSeparations(sep *xmpuzzle.Separation, path string, si int, ids []burrutils.Id_t, pieces map[burrutils.Id_t]*annotation_t, pos [][3]int, moving []bool) *VerifyError_t {
+	groups := map[string]map[burrutils.Id_t][3]int{"removed": {}, "left": {}}
+	for i, id := range ids {
+		if moving[i] {
+			groups["removed"][id] = pos[i]
+		} else {
+			groups["left"][id] = pos[i]
+		}
+	}
+	done := map[string]bool{}
+	for i := range sep.Separations {
+		sub := &sep.Separations[i]
+		group, ok := groups[sub.Type]
+		if !ok || done[sub.Type] || len(group) < 2 {
+			return &VerifyError_t{Separation: path, State: si, Reason: fmt.Sprintf("unexpected %q separation", sub.Type)}
+		}
+		done[sub.Type] = true
+		subPath := sub.Type
+		if path != "" {
+			subPath = path + "." + sub.Type
+		}
+		if verr := pc.verifySeparation(sub, subPath, pieces, group); verr != nil {
+			return verr
+		}
+	}
+	for _, t := range []string{"removed", "left"} {
+		if len(groups[t]) > 1 && !done[t] {
+			return &VerifyError_t{Separation: path, State: si, Reason: fmt.Sprintf("the %s pieces are not separated", t)}
+		}
+	}
+	return nil
+}
+
+/*
+stateMove returns the move between 2 states: the pieces that move, and the axis, direction and distance.
+All pieces that move need to move the same way along 1 axis.
+*/
+func stateMove(from, to [][3]int) (moving []bool, dim, sign, distance int, err error) {
+	moving = make([]bool, len(from))
+	var delta [3]int
+	found := false
+	for i := range from {
+		d := [3]int{to[i][0] - from[i][0], to[i][1] - from[i][1], to[i][2] - from[i][2]}
+		if d == [3]int{} {
+			continue
+		}
+		if found && d != delta {
+			return nil, 0, 0, 0, errors.New("pieces move in different directions")
+		}
+		found = true
+		delta = d
+		moving[i] = true
+	}
+	if !found {
+		return nil, 0, 0, 0, errors.New("no piece moves")
+	}
+	axes := 0
+	for i, d := range delta {
+		if d != 0 {
+			axes++
+			dim = i
+		}
+	}
+	if axes != 1 {
+		return nil, 0, 0, 0, errors.New("pieces move along more than 1 axis")
+	}
+	sign, distance = 1, delta[dim]
+	if distance < 0 {
+		sign, distance = -1, -distance
+	}
+	return moving, dim, sign, distance, nil
+}
+
+/*
+collision slides the moving pieces unit by unit from the positions in pos, over distance units along dim.
+A removal slides them until they are clear of the other pieces.
+It returns the first moving piece that hits a piece that stands still.
+*/
+func (pc *ProblemCache_t) collision(ids []burrutils.Id_t, pieces map[burrutils.Id_t]*annotation_t, pos [][3]int, moving []bool, dim, sign, distance int) (a, b burrutils.Id_t, hit bool) {
+	origin := pc.resultInstance.hotspot
+	type voxel_t struct {
+		p  [3]int
+		id burrutils.Id_t
+	}
+	occupied := make(map[[3]int]burrutils.Id_t)
+	var movers []voxel_t
+	low, high := 0, 0
+	for i, id := range ids {
+		annot := pieces[id]
+		piecemap := *pc.GetShapeInstance(id, annot.rotation).GetWorldmap()
+		for key := 0; key < piecemap.Size(); key++ {
+			p := piecemap.Position(key)
+			var v [3]int
+			for d := 0; d < 3; d++ {
+				v[d] = int(p[d]) + pos[i][d] + int(origin[d]) - int(annot.hotspot[d])
+			}
+			low, high = min(low, v[dim]), max(high, v[dim])
+			if moving[i] {
+				movers = append(movers, voxel_t{v, id})
+			} else {
+				occupied[v] = id
+			}
+		}
+	}
+	if distance >= xmpuzzle.RemovedDistance {
+		// after this many steps the moving pieces are past all the others
+		distance = high - low + 1
+	}
+	for step := 1; step <= distance; step++ {
+		for _, m := range movers {
+			v := m.p
+			v[dim] += sign * step
+			if other, ok := occupied[v]; ok {
+				return m.id, other, true
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,236 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/kgeusens/go/burr-data/dlx"
+)
+
+func TestDlxKnuth(t *testing.T) {
+	// the example of Knuth's Dancing Links paper, with 1 solution
+	m := dlx.NewMatrix[string]()
+	if _, err := m.AddPrimary("A", "B", "C", "D", "E", "F", "G"); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{"CEF", "ADG", "BCF", "AD", "BG", "DEG"} {
+		names := make([]string, len(row))
+		for i, c := range row {
+			names[i] = string(c)
+		}
+		if _, err := m.AddNamedRow(row, names...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var solutions [][]string
+	err := m.Search(context.Background(), func(solution []*dlx.Row[string]) bool {
+		var rows []string
+		for _, r := range solution {
+			rows = append(rows, r.Data)
+		}
+		slices.Sort(rows)
+		solutions = append(solutions, rows)
+		return true
+	})
+	if err != nil || len(solutions) != 1 || !slices.Equal(solutions[0], []string{"AD", "BG", "CEF"}) {
+		t.Errorf("expected the solution AD BG CEF, got %v %v", solutions, err)
+	}
+	if _, err := m.AddNamedRow("X", "X"); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+	if _, err := m.AddPrimary("A"); err == nil {
+		t.Error("expected an error for a duplicate column")
+	}
+}
+
+func TestDlxQueens(t *testing.T) {
+	// 8 queens: the ranks and files are primary, the diagonals secondary
+	const n = 8
+	m := dlx.NewMatrix[[2]int]()
+	for i := 0; i < n; i++ {
+		m.AddPrimary(fmt.Sprint("rank", i), fmt.Sprint("file", i))
+	}
+	for i := 0; i < 2*n-1; i++ {
+		m.AddSecondary(fmt.Sprint("diag", i), fmt.Sprint("anti", i))
+	}
+	for r := 0; r < n; r++ {
+		for f := 0; f < n; f++ {
+			m.AddNamedRow([2]int{r, f}, fmt.Sprint("rank", r), fmt.Sprint("file", f), fmt.Sprint("diag", r+f), fmt.Sprint("anti", r-f+n-1))
+		}
+	}
+	it := m.Iterator(context.Background())
+	count := 0
+	for it.Next() {
+		if len(it.Solution()) != n {
+			t.Fatalf("expected %d queens, got %d", n, len(it.Solution()))
+		}
+		count++
+	}
+	if count != 92 {
+		t.Errorf("expected 92 solutions, got %d", count)
+	}
+	// a cancelled context stops the search
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Search(ctx, func([]*dlx.Row[[2]int]) bool { return true }); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDlxDeep(t *testing.T) {
+	// a strip of 500 cells covered by monominoes and dominoes needs more than 100 levels
+	const n = 500
+	m := dlx.NewMatrix[int]()
+	for i := 0; i < n; i++ {
+		m.AddPrimary(fmt.Sprint(i))
+	}
+	for i := 0; i < n; i++ {
+		m.AddRow(1, i)
+		if i+1 < n {
+			m.AddRow(2, i, i+1)
+		}
+	}
+	it := m.Iterator(context.Background())
+	if !it.Next() || len(it.Solution()) != n {
+		t.Errorf("expected a first solution with %d monominoes", n)
+	}
+	if !it.Next() {
+		t.Error("expected a second solution")
+	}
+}
+
+func TestDlxColors(t *testing.T) {
+	// the example of Knuth's Algorithm C: rows can share the secondary column x when they give it the same color
+	m := dlx.NewMatrix[int]()
+	m.AddPrimary("p", "q", "r")
+	m.AddSecondary("x", "y")
+	rows := []struct {
+		names, colors []string
+	}{
+		{[]string{"p", "q", "x", "y"}, []string{"", "", "", "A"}},
+		{[]string{"p", "r", "x", "y"}, []string{"", "", "A", ""}},
+		{[]string{"p", "x"}, []string{"", "B"}},
+		{[]string{"q", "x"}, []string{"", "A"}},
+		{[]string{"r", "y"}, []string{"", "B"}},
+	}
+	for i, row := range rows {
+		if _, err := m.AddNamedColoredRow(i+1, row.names, row.colors); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var solutions [][]int
+	m.Search(context.Background(), func(solution []*dlx.Row[int]) bool {
+		var s []int
+		for _, r := range solution {
+			s = append(s, r.Data)
+		}
+		slices.Sort(s)
+		solutions = append(solutions, s)
+		return true
+	})
+	if len(solutions) != 1 || !slices.Equal(solutions[0], []int{2, 4}) {
+		t.Errorf("expected the solution with rows 2 and 4, got %v", solutions)
+	}
+	if _, err := m.AddNamedColoredRow(0, []string{"p"}, []string{"A"}); !errors.Is(err, dlx.ErrColor) {
+		t.Errorf("expected ErrColor for a colored primary column, got %v", err)
+	}
+	if _, err := m.AddNamedRow(0, "x", "y"); !errors.Is(err, dlx.ErrEmptyRow) {
+		t.Errorf("expected ErrEmptyRow for a row without primary columns, got %v", err)
+	}
+}
+
+func TestDlxMultiplicity(t *testing.T) {
+	// pick 2 or 3 of 5 rows, exactly one of them is row 1 or 2: 2 * (3 + 3) solutions
+	m := dlx.NewMatrix[int]()
+	pick, _ := m.AddBounded(2, 3, "pick")
+	x, _ := m.AddPrimary("x")
+	for i := 1; i <= 5; i++ {
+		if i <= 2 {
+			m.AddRow(i, pick, x)
+		} else {
+			m.AddRow(i, pick)
+		}
+	}
+	found := 0
+	m.Search(context.Background(), func(solution []*dlx.Row[int]) bool {
+		if len(solution) < 2 || len(solution) > 3 {
+			t.Errorf("expected 2 or 3 rows, got %d", len(solution))
+		}
+		found++
+		return true
+	})
+	if found != 12 {
+		t.Errorf("expected 12 solutions, got %d", found)
+	}
+	for _, memoize := range []bool{false, true} {
+		if count := m.Iterator(context.Background()).Count(memoize); count != 12 {
+			t.Errorf("expected a count of 12 with memoize %v, got %d", memoize, count)
+		}
+	}
+	if _, err := m.AddBounded(2, 1, "bad"); !errors.Is(err, dlx.ErrBounds) {
+		t.Errorf("expected ErrBounds for min > max, got %v", err)
+	}
+}
+
+func TestDlxParallel(t *testing.T) {
+	// the solutions of 10 queens come in the order of the serial search
+	const n = 10
+	m := dlx.NewMatrix[int]()
+	for i := 0; i < n; i++ {
+		m.AddPrimary(fmt.Sprint("rank", i), fmt.Sprint("file", i))
+	}
+	for i := 0; i < 2*n-1; i++ {
+		m.AddSecondary(fmt.Sprint("diag", i), fmt.Sprint("anti", i))
+	}
+	for r := 0; r < n; r++ {
+		for f := 0; f < n; f++ {
+			m.AddNamedRow(r*n+f, fmt.Sprint("rank", r), fmt.Sprint("file", f), fmt.Sprint("diag", r+f), fmt.Sprint("anti", r-f+n-1))
+		}
+	}
+	var want []int
+	m.Search(context.Background(), func(solution []*dlx.Row[int]) bool {
+		want = append(want, solution[0].Data, solution[n-1].Data)
+		return true
+	})
+	for _, depth := range []int{0, 1, 2} {
+		for _, steal := range []bool{false, true} {
+			p := m.Parallel(context.Background())
+			p.Workers, p.Depth, p.Steal = 4, depth, steal
+			var got []int
+			if err := p.Search(func(solution []*dlx.Row[int]) bool {
+				got = append(got, solution[0].Data, solution[n-1].Data)
+				return true
+			}); err != nil || !slices.Equal(got, want) {
+				t.Errorf("depth %d steal %v: expected the %d solutions of the serial search, got %d %v", depth, steal, len(want)/2, len(got)/2, err)
+			}
+			p = m.Parallel(context.Background())
+			p.Workers, p.Depth, p.Steal = 4, depth, steal
+			if count := p.Count(true); count != 724 {
+				t.Errorf("depth %d steal %v: expected a count of 724, got %d", depth, steal, count)
+			}
+		}
+	}
+	// with a budget the solutions are the first ones of the serial search
+	for _, maxSteps := range []int{1000, 2000, 4000, 8000} {
+		p := m.Parallel(context.Background())
+		p.Workers, p.MaxSteps = 4, maxSteps
+		var got []int
+		err := p.Search(func(solution []*dlx.Row[int]) bool {
+			got = append(got, solution[0].Data, solution[n-1].Data)
+			return true
+		})
+		if !errors.Is(err, dlx.ErrBudgetExceeded) || !slices.Equal(got, want[:len(got)]) {
+			t.Errorf("max steps %d: expected a prefix of the solutions of the serial search, got %d %v", maxSteps, len(got)/2, err)
+		}
+	}
+	// stop after the first 10 solutions
+	p := m.Parallel(context.Background())
+	found := 0
+	p.Search(func([]*dlx.Row[int]) bool { found++; return found < 10 })
+	if found != 10 {
+		t.Errorf("expected to stop after 10 solutions, got %d", found)
+	}
+}
@@ -0,0 +1,596 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kgeusens/go/burr-data/dlx"
+	"github.com/kgeusens/go/burr-data/solver"
+	"github.com/kgeusens/go/burr-data/xmpuzzle"
+)
+
+/*
+rangePuzzle fills an asymmetric shape of 5 cubes with monominoes and dominoes.
+The result has no symmetries, so every assembly is a different tiling.
+*/
+func rangePuzzle(mono, domino xmpuzzle.Shape) *xmpuzzle.Puzzle {
+	mono.Id, domino.Id = 0, 1
+	return &xmpuzzle.Puzzle{
+		Shapes: []xmpuzzle.Voxel{{X: 1, Y: 1, Z: 1, Text: "#"}, {X: 2, Y: 1, Z: 1, Text: "##"}, {X: 3, Y: 2, Z: 1, Text: "#####_"}},
+		Problems: []xmpuzzle.Problem{{
+			Shapes: []xmpuzzle.Shape{mono, domino},
+			Result: xmpuzzle.Result{Id: 2},
+		}},
+	}
+}
+
+func TestPieceRanges(t *testing.T) {
+	tests := []struct {
+		mono, domino xmpuzzle.Shape
+		assemblies   int
+	}{
+		{xmpuzzle.Shape{Min: 0, Max: 5}, xmpuzzle.Shape{Min: 0, Max: 2}, 10},
+		{xmpuzzle.Shape{Min: 0, Max: 3}, xmpuzzle.Shape{Min: 0, Max: 2}, 9},
+		{xmpuzzle.Shape{Min: 2, Max: 5}, xmpuzzle.Shape{Min: 0, Max: 2}, 6},
+		{xmpuzzle.Shape{Count: 3}, xmpuzzle.Shape{Count: 1}, 5},
+		{xmpuzzle.Shape{Min: 1, Max: 1}, xmpuzzle.Shape{Min: 1, Max: 2}, 4},
+	}
+	for _, test := range tests {
+		cache := solver.NewProblemCache(rangePuzzle(test.mono, test.domino), 0)
+		if n := len(cache.GetAssemblies()); n != test.assemblies {
+			t.Errorf("monomino %+v domino %+v: expected %d assemblies, got %d", test.mono, test.domino, test.assemblies, n)
+		}
+		cache.MemoizeCount = true
+		if n := cache.CountAssemblies(); n != test.assemblies {
+			t.Errorf("monomino %+v domino %+v: expected a count of %d assemblies, got %d", test.mono, test.domino, test.assemblies, n)
+		}
+	}
+}
+
+func TestMaxHoles(t *testing.T) {
+	tests := []struct {
+		mono       xmpuzzle.Shape
+		maxHoles   int
+		assemblies int
+	}{
+		{xmpuzzle.Shape{Min: 0, Max: 5}, -1, 4},
+		{xmpuzzle.Shape{Min: 0, Max: 5}, 2, 4},
+		{xmpuzzle.Shape{Min: 0, Max: 5}, 1, 3},
+		{xmpuzzle.Shape{Min: 0, Max: 5}, 0, 1},
+		{xmpuzzle.Shape{Count: 4}, -1, 2},
+		{xmpuzzle.Shape{Count: 4}, 1, 2},
+		{xmpuzzle.Shape{Count: 4}, 0, 0},
+	}
+	for _, test := range tests {
+		// 3 filled and 2 variable voxels, no symmetries
+		puzzle := &xmpuzzle.Puzzle{
+			Shapes: []xmpuzzle.Voxel{{X: 1, Y: 1, Z: 1, Text: "#"}, {X: 3, Y: 2, Z: 1, Text: "###++_"}},
+			Problems: []xmpuzzle.Problem{{
+				Shapes: []xmpuzzle.Shape{test.mono},
+				Result: xmpuzzle.Result{Id: 1},
+			}},
+		}
+		puzzle.Problems[0].SetMaxHoles(test.maxHoles)
+		cache := solver.NewProblemCache(puzzle, 0)
+		if n := len(cache.GetAssemblies()); n != test.assemblies {
+			t.Errorf("monomino %+v max holes %d: expected %d assemblies, got %d", test.mono, test.maxHoles, test.assemblies, n)
+		}
+		cache.MemoizeCount = true
+		if n := cache.CountAssemblies(); n != test.assemblies {
+			t.Errorf("monomino %+v max holes %d: expected a count of %d assemblies, got %d", test.mono, test.maxHoles, test.assemblies, n)
+		}
+	}
+}
+
+func TestColors(t *testing.T) {
+	puzzle := &xmpuzzle.Puzzle{
+		Colors: []xmpuzzle.Color{{Red: 255}, {Blue: 255}},
+		Shapes: []xmpuzzle.Voxel{{X: 1, Y: 1, Z: 1, Text: "#1"}, {X: 1, Y: 1, Z: 1, Text: "#2"}, {X: 1, Y: 1, Z: 1, Text: "#"}, {X: 3, Y: 1, Z: 1, Text: "#1#2#"}},
+		Problems: []xmpuzzle.Problem{{
+			Shapes: []xmpuzzle.Shape{{Id: 0, Count: 1}, {Id: 1, Count: 1}, {Id: 2, Count: 1}},
+			Result: xmpuzzle.Result{Id: 3},
+		}},
+	}
+	if c := puzzle.Shapes[3].GetVoxelColor(1, 0, 0); c != 2 {
+		t.Errorf("expected color 2, got %d", c)
+	}
+	if s := puzzle.Shapes[3].GetVoxelState(2, 0, 0); s != 1 {
+		t.Errorf("expected state 1, got %d", s)
+	}
+	// without pairs the colored pieces can only go on the neutral voxel
+	cache := solver.NewProblemCache(puzzle, 0)
+	if n := len(cache.GetAssemblies()); n != 0 {
+		t.Errorf("no color pairs: expected 0 assemblies, got %d", n)
+	}
+	puzzle.Problems[0].Bitmap = []xmpuzzle.Pair{{Piece: 0, Result: 0}, {Piece: 1, Result: 1}}
+	cache = solver.NewProblemCache(puzzle, 0)
+	if n := len(cache.GetAssemblies()); n != 3 {
+		t.Errorf("matching colors: expected 3 assemblies, got %d", n)
+	}
+}
+
+func TestSolveAll(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := solver.NewProblemCache(puzzle, 0)
+	solved, err := cache.SolveAll(context.Background(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range cache.GetAssemblies() {
+		if !reflect.DeepEqual(solved[i], cache.Solve(a, i)) {
+			t.Errorf("assembly %d: SolveAll and Solve disagree", i)
+		}
+	}
+	if n := countSolved(solved); n != puzzle.Problems[0].SolutionCount {
+		t.Errorf("expected %d solutions, got %d", puzzle.Problems[0].SolutionCount, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.SolveAll(ctx, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func countSolved(list []*xmpuzzle.Separation) (n int) {
+	for _, sep := range list {
+		if sep != nil {
+			n++
+		}
+	}
+	return
+}
+
+func TestEachAssembly(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := puzzle.Problems[0].Assemblies
+
+	cache := solver.NewProblemCache(puzzle, 0)
+	n := 0
+	if cache.EachAssembly(func(a solver.Assembly_t) bool { n++; return true }) || n != total {
+		t.Errorf("expected all %d assemblies without hitting the limit, got %d", total, n)
+	}
+	n = 0
+	if cache.EachAssembly(func(a solver.Assembly_t) bool { n++; return n < 5 }); n != 5 {
+		t.Errorf("expected to stop after 5 assemblies, got %d", n)
+	}
+
+	cache = solver.NewProblemCache(puzzle, 0)
+	cache.MaxAssemblies = 10
+	if n := len(cache.GetAssemblies()); n != 10 || !cache.AssemblyLimitReached() {
+		t.Errorf("expected 10 assemblies and the limit reached, got %d %v", n, cache.AssemblyLimitReached())
+	}
+}
+
+func TestParallelAssembly(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("two face 3.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := solver.NewProblemCache(puzzle, 0)
+	want := serial.GetAssemblies()
+	for _, steal := range []bool{false, true} {
+		cache := solver.NewProblemCache(puzzle, 0)
+		cache.AssemblyWorkers, cache.AssemblySteal = 4, steal
+		got := cache.GetAssemblies()
+		if len(got) != len(want) {
+			t.Fatalf("steal %v: expected %d assemblies, got %d", steal, len(want), len(got))
+		}
+		for i := range want {
+			if cache.EncodeAssembly(got[i]) != serial.EncodeAssembly(want[i]) {
+				t.Fatalf("steal %v: assembly %d is not the one of the serial search", steal, i)
+			}
+		}
+		cache.MemoizeCount = true
+		if n := cache.CountAssemblies(); n != len(want) {
+			t.Errorf("steal %v: expected a count of %d assemblies, got %d", steal, len(want), n)
+		}
+	}
+}
+
+func TestCountAssemblies(t *testing.T) {
+	for _, file := range []string{"two face 3.xmpuzzle", "Misused Key.xmpuzzle", "chocolate dip.xmpuzzle"} {
+		puzzle, err := xmpuzzle.LoadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache := solver.NewProblemCache(puzzle, 0)
+		for _, memoize := range []bool{false, true} {
+			cache.MemoizeCount = memoize
+			if n, err := cache.CountAssembliesContext(context.Background()); err != nil || n != len(cache.GetAssemblies()) {
+				t.Errorf("%s memoize %v: expected a count of %d assemblies, got %d %v", file, memoize, len(cache.GetAssemblies()), n, err)
+			}
+		}
+	}
+}
+
+func TestBudgets(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := solver.NewProblemCache(puzzle, 0)
+	cache.MaxSearchSteps = 10
+	n := 0
+	if _, err := cache.EachAssemblyContext(context.Background(), func(a solver.Assembly_t) bool { n++; return true }); !errors.Is(err, solver.ErrBudgetExceeded) {
+		t.Errorf("expected ErrBudgetExceeded from the assembler, got %v", err)
+	}
+	if n >= puzzle.Problems[0].Assemblies {
+		t.Errorf("expected a partial list of assemblies, got %d", n)
+	}
+
+	// an assembly that can be disassembled needs more than one node
+	cache = solver.NewProblemCache(puzzle, 0)
+	for i, a := range cache.GetAssemblies() {
+		if cache.Solve(a, i) == nil {
+			continue
+		}
+		cache.MaxSolveNodes = 1
+		if sep, err := cache.SolveContext(context.Background(), a, i); sep != nil || !errors.Is(err, solver.ErrBudgetExceeded) {
+			t.Errorf("assembly %d: expected ErrBudgetExceeded from the solver, got %v %v", i, sep, err)
+		}
+		cache.MaxSolveNodes = 0
+	}
+
+	// a larger budget gives the separations found so far, the first one is that of the complete solution
+	partials := 0
+	for i, a := range cache.GetAssemblies() {
+		full := cache.Solve(a, i)
+		if full == nil {
+			continue
+		}
+		for cache.MaxSolveNodes = 1; ; cache.MaxSolveNodes *= 2 {
+			sep, err := cache.SolveContext(context.Background(), a, i)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, solver.ErrBudgetExceeded) {
+				t.Fatalf("assembly %d: expected ErrBudgetExceeded from the solver, got %v", i, err)
+			}
+			if sep == nil {
+				continue
+			}
+			partials++
+			if !reflect.DeepEqual(sep.Pieces, full.Pieces) || !reflect.DeepEqual(sep.State, full.State) {
+				t.Errorf("assembly %d: the partial separation differs from the solution", i)
+			}
+			if cache.Solve(a, i) != nil {
+				t.Errorf("assembly %d: Solve returned a partial separation", i)
+			}
+		}
+		cache.MaxSolveNodes = 0
+	}
+	if partials == 0 {
+		t.Error("expected a partial separation tree")
+	}
+}
+
+func TestColumnBounds(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := solver.NewSearchconfig(solver.NewProblemCache(puzzle, 0))
+	config.AddColumn(2, 1)
+	if _, err := config.SearchContext(context.Background()); !errors.Is(err, dlx.ErrBounds) {
+		t.Errorf("expected %v for a column with min > max, got %v", dlx.ErrBounds, err)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last [2]solver.Progress_t
+	var mu sync.Mutex
+	cache := solver.NewProblemCache(puzzle, 0)
+	cache.Observer = solver.ObserverFunc_t(func(p solver.Progress_t) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p.Done {
+			last[p.Phase] = p
+		}
+	})
+	if _, err := cache.SolveAll(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	pb := puzzle.Problems[0]
+	if p := last[solver.AssemblyPhase]; p.AssembliesFound != pb.Assemblies || p.Nodes == 0 {
+		t.Errorf("assembler: expected %d assemblies, got %+v", pb.Assemblies, p)
+	}
+	if p := last[solver.SolvePhase]; p.AssembliesAnalysed == 0 || p.MovementCacheHits+p.MovementCacheMisses == 0 {
+		t.Errorf("solver: no progress reported, got %+v", p)
+	}
+}
+
+func TestSolveProblem(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb := &puzzle.Problems[0]
+	expected := map[string]bool{}
+	for _, s := range pb.Solutions {
+		expected[s.Assembly.Text] = true
+	}
+	assemblies, solutions := pb.Assemblies, pb.SolutionCount
+	cache := solver.NewProblemCache(puzzle, 0)
+	// a call that stops before it starts leaves the problem as it is
+	original := *pb
+	original.Solutions = slices.Clone(pb.Solutions)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cache.SolveProblem(ctx, 2); !errors.Is(err, context.Canceled) || !reflect.DeepEqual(*pb, original) {
+		t.Errorf("expected %v and the problem unchanged, got %v", context.Canceled, err)
+	}
+	if err := cache.SolveProblem(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	if pb.Assemblies != assemblies || pb.SolutionCount != solutions || len(pb.Solutions) != solutions || pb.State != 2 {
+		t.Errorf("expected %d assemblies and %d solutions, got %d %d %d state %d", assemblies, solutions, pb.Assemblies, pb.SolutionCount, len(pb.Solutions), pb.State)
+	}
+	for _, s := range pb.Solutions {
+		if !expected[s.Assembly.Text] {
+			t.Errorf("assembly %d: %q is not a solution of BurrTools", s.AsmNum, s.Assembly.Text)
+		}
+		sep := s.Separation
+		if sep == nil || sep.Pieces.Text != "0 1 2 3 4" || len(sep.State) < 2 {
+			t.Fatalf("assembly %d: unexpected separation %+v", s.AsmNum, sep)
+		}
+		// the first state holds the positions of the assembly
+		fields := strings.Fields(s.Assembly.Text)
+		x, y, z := sep.State[0].X(), sep.State[0].Y(), sep.State[0].Z()
+		for i := range x {
+			if x[i] != fields[i*4] || y[i] != fields[i*4+1] || z[i] != fields[i*4+2] {
+				t.Errorf("assembly %d: piece %d is at %s %s %s in the first state", s.AsmNum, i, x[i], y[i], z[i])
+			}
+		}
+	}
+}
+
+func TestKeepHighestLevel(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := solver.NewProblemCache(puzzle, 0)
+	cache.KeepHighestLevel = 2
+	if err := cache.SolveProblem(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	pb := &puzzle.Problems[0]
+	if pb.SolutionCount != 6 || len(pb.Solutions) != 2 {
+		t.Fatalf("expected 6 solutions and 2 kept, got %d %d", pb.SolutionCount, len(pb.Solutions))
+	}
+	if xmpuzzle.CompareLevel(pb.Solutions[0].Separation, pb.Solutions[1].Separation) < 0 {
+		t.Errorf("expected the highest level first, got %s and %s", pb.Solutions[0].Level(), pb.Solutions[1].Level())
+	}
+	// the kept solutions are the first ones of all the solutions sorted on their level
+	all, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allCache := solver.NewProblemCache(all, 0)
+	if err := allCache.SolveProblem(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	sorted := slices.Clone(all.Problems[0].Solutions)
+	slices.SortStableFunc(sorted, func(a, b xmpuzzle.Solution) int { return xmpuzzle.CompareLevel(b.Separation, a.Separation) })
+	for i := range pb.Solutions {
+		if pb.Solutions[i].AsmNum != sorted[i].AsmNum || pb.Solutions[i].SolNum != sorted[i].SolNum {
+			t.Errorf("solution %d: expected assembly %d solution %d, got %d %d", i, sorted[i].AsmNum, sorted[i].SolNum, pb.Solutions[i].AsmNum, pb.Solutions[i].SolNum)
+		}
+	}
+}
+
+func TestShortestMoves(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cutler := solver.NewProblemCache(puzzle, 0)
+	shortest := solver.NewProblemCache(puzzle, 0)
+	shortest.ShortestMoves = true
+	// the moves until the first separation are the ones of the solutions that BurrTools stored
+	stored := map[string]*xmpuzzle.Separation{}
+	for _, s := range puzzle.Problems[0].Solutions {
+		stored[s.Assembly.Text] = s.Separation
+	}
+	// BurrTools moves 2 pieces at once, the first separation of assembly 4 takes 2 moves instead of 3
+	moves := map[int][2]int{4: {3, 2}}
+	for i, a := range cutler.GetAssemblies() {
+		s1, s2 := cutler.Solve(a, i), shortest.Solve(a, i)
+		if (s1 == nil) != (s2 == nil) {
+			t.Fatalf("assembly %d: expected the same result in both modes", i)
+		}
+		if s1 == nil {
+			continue
+		}
+		want := stored[shortest.EncodeAssembly(a)]
+		if want == nil {
+			t.Fatalf("assembly %d is not a solution of BurrTools", i)
+		}
+		if s2.Moves() != want.Moves() {
+			t.Errorf("assembly %d: expected %d moves like BurrTools, got %d", i, want.Moves(), s2.Moves())
+		}
+		if m, ok := moves[i]; ok && (s1.Moves() != m[0] || s2.Moves() != m[1]) {
+			t.Errorf("assembly %d: expected %d and %d moves, got %d and %d", i, m[0], m[1], s1.Moves(), s2.Moves())
+		}
+		if _, err := s2.AllMoves(); err != nil {
+			t.Errorf("assembly %d: %v", i, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := solver.NewProblemCache(puzzle, 0)
+	for i, err := range cache.VerifySolutions() {
+		if err != nil {
+			t.Errorf("solution %d: %v", i, err)
+		}
+	}
+	// a piece that moved out of its place
+	sol := puzzle.Problems[0].Solutions[0]
+	fields := strings.Fields(sol.Assembly.Text)
+	fields[0] = "1"
+	sol.Assembly.Text = strings.Join(fields, " ")
+	var verr *solver.VerifyError_t
+	if err := cache.VerifySolution(&sol); !errors.As(err, &verr) || verr.State != -1 {
+		t.Errorf("expected an invalid assembly, got %v", err)
+	}
+	// without the first move the removal collides
+	sol = puzzle.Problems[0].Solutions[0]
+	sep := *sol.Separation
+	sep.State = append([]xmpuzzle.State{sep.State[0]}, sep.State[2:]...)
+	sol.Separation = &sep
+	if err := cache.VerifySolution(&sol); !errors.As(err, &verr) || verr.State != 1 || verr.Separation != "" {
+		t.Errorf("expected a collision in state 1, got %v", err)
+	}
+}
+
+func TestManyPieces(t *testing.T) {
+	// 36 unit cubes in a 3x3x4 box
+	puzzle := &xmpuzzle.Puzzle{
+		Shapes: []xmpuzzle.Voxel{{X: 1, Y: 1, Z: 1, Text: "#"}, {X: 3, Y: 3, Z: 4, Text: strings.Repeat("#", 36)}},
+		Problems: []xmpuzzle.Problem{{
+			Shapes: []xmpuzzle.Shape{{Id: 0, Count: 36}},
+			Result: xmpuzzle.Result{Id: 1},
+		}},
+	}
+	if err := puzzle.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cache := solver.NewProblemCache(puzzle, 0)
+	var text []string
+	for i := 0; i < 36; i++ {
+		text = append(text, fmt.Sprintf("%d %d %d 0", i%3, i/3%3, i/9))
+	}
+	assembly, err := cache.ParseAssembly(strings.Join(text, " "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sep := cache.Solve(assembly, 0)
+	if sep == nil {
+		t.Fatal("expected a disassembly")
+	}
+	sol := xmpuzzle.Solution{Assembly: xmpuzzle.Assembly{Text: cache.EncodeAssembly(assembly)}, Separation: sep}
+	if err := cache.VerifySolution(&sol); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	// 2 sticks of 150 slide more than 100 units along each other before they separate
+	puzzle := &xmpuzzle.Puzzle{
+		Shapes: []xmpuzzle.Voxel{{X: 150, Y: 1, Z: 1, Text: strings.Repeat("#", 150)}, {X: 150, Y: 2, Z: 1, Text: strings.Repeat("#", 300)}},
+		Problems: []xmpuzzle.Problem{{
+			Shapes: []xmpuzzle.Shape{{Id: 0, Count: 2}},
+			Result: xmpuzzle.Result{Id: 1},
+		}},
+	}
+	cache := solver.NewProblemCache(puzzle, 0)
+	solved, err := cache.SolveAll(context.Background(), 1)
+	if err != nil || len(solved) != 1 || solved[0] == nil {
+		t.Fatalf("expected 1 disassembly, got %v %v", solved, err)
+	}
+	if level := solved[0].Level(); level != "1" {
+		t.Errorf("expected level 1, got %s", level)
+	}
+	// the movements of the pieces of the largest problem do not fit in the hash
+	puzzle = &xmpuzzle.Puzzle{
+		Shapes: []xmpuzzle.Voxel{{X: 1, Y: 1, Z: 1, Text: "#"}, {X: 100, Y: 100, Z: 1, Text: strings.Repeat("#", xmpuzzle.MaxPieces)}},
+		Problems: []xmpuzzle.Problem{{
+			Result: xmpuzzle.Result{Id: 1},
+		}},
+	}
+	for n := 0; n < xmpuzzle.MaxPieces; n += 250 {
+		puzzle.Problems[0].Shapes = append(puzzle.Problems[0].Shapes, xmpuzzle.Shape{Id: 0, Count: 250})
+	}
+	cache = solver.NewProblemCache(puzzle, 0)
+	if _, err := cache.SolveContext(context.Background(), nil, 0); !errors.Is(err, solver.ErrTooLarge) {
+		t.Errorf("expected %v, got %v", solver.ErrTooLarge, err)
+	}
+	// 2 long pieces fit in the hash, but their offsets do not fit in a Distance_t
+	long := strings.Repeat("#", 20000)
+	puzzle = &xmpuzzle.Puzzle{
+		Shapes: []xmpuzzle.Voxel{{X: 20000, Y: 1, Z: 1, Text: long}, {X: 20000, Y: 1, Z: 1, Text: long}},
+		Problems: []xmpuzzle.Problem{{
+			Shapes: []xmpuzzle.Shape{{Id: 0, Count: 1}},
+			Result: xmpuzzle.Result{Id: 1},
+		}},
+	}
+	cache = solver.NewProblemCache(puzzle, 0)
+	if _, err := cache.SolveContext(context.Background(), nil, 0); !errors.Is(err, solver.ErrTooLarge) {
+		t.Errorf("expected %v for pieces that are too long, got %v", solver.ErrTooLarge, err)
+	}
+	if err := cache.SolveProblem(context.Background(), 0); !errors.Is(err, solver.ErrTooLarge) || puzzle.Problems[0].State != 0 || puzzle.Problems[0].Time != 0 {
+		t.Errorf("expected %v and the problem unchanged, got %v", solver.ErrTooLarge, err)
+	}
+}
+
+func TestDropMirrors(t *testing.T) {
+	// every piece of chocolate dip is its own mirror image, BurrTools only keeps one of every mirror pair
+	for _, test := range []struct {
+		file                  string
+		assemblies, solutions int
+	}{{"chocolate dip.xmpuzzle", 960, 21}, {"magic drawer.xmpuzzle", 35, 6}} {
+		puzzle, err := xmpuzzle.LoadFile(test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache := solver.NewProblemCache(puzzle, 0)
+		cache.DropMirrors = true
+		solved, err := cache.SolveAll(context.Background(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(solved) != test.assemblies {
+			t.Errorf("%s: expected %d assemblies, got %d", test.file, test.assemblies, len(solved))
+		}
+		if n := countSolved(solved); n != test.solutions {
+			t.Errorf("%s: expected %d solutions, got %d", test.file, test.solutions, n)
+		}
+	}
+}
+
+func TestDropDuplicates(t *testing.T) {
+	domino := xmpuzzle.Voxel{X: 2, Y: 1, Z: 1, Text: "##"}
+	tests := []struct {
+		result                xmpuzzle.Voxel
+		dominoes              uint8
+		assemblies, duplicate int
+	}{
+		// all dominoes parallel, or 2 layers in different directions
+		{xmpuzzle.Voxel{X: 2, Y: 2, Z: 2, Text: "########"}, 4, 2, 3},
+		// 3 parallel dominoes, or a square of 2 next to 1 on the left or on the right
+		{xmpuzzle.Voxel{X: 3, Y: 2, Z: 1, Text: "######"}, 3, 2, 1},
+	}
+	for _, test := range tests {
+		puzzle := &xmpuzzle.Puzzle{
+			Shapes:   []xmpuzzle.Voxel{domino, test.result},
+			Problems: []xmpuzzle.Problem{{Shapes: []xmpuzzle.Shape{{Id: 0, Count: test.dominoes}}, Result: xmpuzzle.Result{Id: 1}}},
+		}
+		cache := solver.NewProblemCache(puzzle, 0)
+		cache.DropDuplicates = true
+		if n := len(cache.GetAssemblies()); n != test.assemblies || cache.DuplicatesRemoved() != test.duplicate {
+			t.Errorf("%d dominoes: expected %d assemblies and %d duplicates, got %d and %d", test.dominoes, test.assemblies, test.duplicate, n, cache.DuplicatesRemoved())
+		}
+	}
+}
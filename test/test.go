@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -14,6 +15,8 @@ import (
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
 var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
+var workers = flag.Int("workers", 0, "number of assemblies to solve in parallel, 0 uses all cores")
+var assemblyWorkers = flag.Int("assemblyworkers", 1, "number of goroutines the assembler splits its search over")
 
 func main() {
 
@@ -46,23 +49,23 @@ func main() {
 		})
 	*/
 
-	xmlstring, err := xmpuzzle.ReadFile("./3D Onat.xmpuzzle")
+	puzzle, err := xmpuzzle.LoadFile("./3D Onat.xmpuzzle")
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	// we have an xml string now
-	puzzle := xmpuzzle.ParseXML(xmlstring)
-	cache := solver.NewProblemCache(&puzzle, 0)
+	cache := solver.NewProblemCache(puzzle, 0)
+	cache.AssemblyWorkers = *assemblyWorkers
 	assemblies := cache.GetAssemblies()
 	fmt.Println(len(assemblies), "assemblies to test")
-	for i, a := range assemblies {
-		res := cache.Solve(a, i)
-		if res {
+	solved, err := cache.SolveAll(context.Background(), *workers)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for i, res := range solved {
+		if res != nil {
 			fmt.Println("Solution at", i)
-			//			for _, v := range a {
-			//				fmt.Println(*v)
-			//			}
 		}
 	}
 	if *memprofile != "" {
@@ -0,0 +1,414 @@
+package main_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kgeusens/go/burr-data/burrutils"
+	"github.com/kgeusens/go/burr-data/xmpuzzle"
+)
+
+func TestRoundtrip(t *testing.T) {
+	files, _ := filepath.Glob("*.xmpuzzle")
+	for _, f := range files {
+		puzzle, err := xmpuzzle.LoadFile(f)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+
+		var b bytes.Buffer
+		if err := xmpuzzle.Encode(&b, puzzle); err != nil {
+			t.Fatal(f, err)
+		}
+		r, err := gzip.NewReader(&b)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		encoded, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		reread, err := xmpuzzle.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		if !reflect.DeepEqual(puzzle, reread) {
+			t.Errorf("%s: puzzle changed after a roundtrip", f)
+		}
+	}
+}
+
+/*
+xmlTokens returns the elements, attributes and text of an XML document, without the layout:
+whitespace between elements, the order of attributes and the way an empty element is written
+*/
+func xmlTokens(t *testing.T, data []byte) (tokens []string) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return tokens
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			attrs := []string{}
+			for _, a := range tok.Attr {
+				attrs = append(attrs, a.Name.Local+"="+a.Value)
+			}
+			slices.Sort(attrs)
+			tokens = append(tokens, "<"+tok.Name.Local+" "+strings.Join(attrs, " ")+">")
+		case xml.EndElement:
+			tokens = append(tokens, "</"+tok.Name.Local+">")
+		case xml.CharData:
+			if text := strings.TrimSpace(string(tok)); text != "" {
+				tokens = append(tokens, text)
+			}
+		}
+	}
+}
+
+func TestRoundtripXML(t *testing.T) {
+	files, _ := filepath.Glob("*.xmpuzzle")
+	for _, f := range files {
+		original, err := xmpuzzle.ReadFile(f)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		puzzle, err := xmpuzzle.Decode(strings.NewReader(original))
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		var b bytes.Buffer
+		if err := xmpuzzle.Encode(&b, puzzle); err != nil {
+			t.Fatal(f, err)
+		}
+		r, err := gzip.NewReader(&b)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		encoded, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		want, got := xmlTokens(t, []byte(original)), xmlTokens(t, encoded)
+		for i := range want {
+			if i >= len(got) || got[i] != want[i] {
+				t.Errorf("%s: token %d is %q after a roundtrip, expected %q", f, i, got[min(i, len(got)-1)], want[i])
+				break
+			}
+		}
+		if len(got) > len(want) {
+			t.Errorf("%s: %d tokens after a roundtrip, expected %d", f, len(got), len(want))
+		}
+	}
+}
+
+func TestUnknownElements(t *testing.T) {
+	original := "<puzzle version=\"2\">\n<gridType type=\"0\"/>\n<colors/>\n<shapes>\n<voxel x=\"1\" y=\"1\" z=\"1\" type=\"0\">#</voxel>\n</shapes>\n" +
+		"<problems>\n<problem name=\"\" state=\"0\" assemblies=\"0\" solutions=\"0\" time=\"0\">\n<shapes>\n<shape id=\"0\" count=\"1\"/>\n</shapes>\n<result id=\"0\"/>\n<bitmap/>\n<solutions/>\n" +
+		"<future level=\"2\">text<item/></future>\n</problem>\n</problems>\n<extension name=\"x\"><data>1 2</data></extension>\n</puzzle>"
+	puzzle, err := xmpuzzle.Decode(strings.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(puzzle.Unknown) != 1 || puzzle.Unknown[0].XMLName.Local != "extension" || len(puzzle.Problems[0].Unknown) != 1 {
+		t.Fatalf("expected the unknown elements to be kept, got %v and %v", puzzle.Unknown, puzzle.Problems[0].Unknown)
+	}
+	var b bytes.Buffer
+	if err := xmpuzzle.Encode(&b, puzzle); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := xmlTokens(t, []byte(original)), xmlTokens(t, encoded); !slices.Equal(want, got) {
+		t.Errorf("unknown elements changed after a roundtrip:\n%v\n%v", want, got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		xml  string
+		err  error
+		line int
+	}{
+		{"", xmpuzzle.ErrNoPuzzle, 1},
+		{"<puzzle version=\"2\">\n<shapes>\n<voxel x=\"2\" y=\"1\" z=\"1\">#</voxel>\n</shapes>\n</puzzle>", xmpuzzle.ErrVoxelSize, 3},
+		{"<puzzle version=\"2\">\n<shapes>\n<voxel x=\"2\" y=\"1\" z=\"1\">#1+2</voxel>\n</shapes>\n<problems>\n<problem>\n<shapes>\n<shape id=\"1\" count=\"1\"/>\n</shapes>\n<result id=\"0\"/>\n</problem>\n</problems>\n</puzzle>", xmpuzzle.ErrUnknownShape, 8},
+		{"<puzzle version=\"2\">\n<shapes>\n<voxel x=\"2\" y=\"1\" z=\"1\">#256+</voxel>\n</shapes>\n</puzzle>", xmpuzzle.ErrUnknownColor, 3},
+	}
+	for _, test := range tests {
+		_, err := xmpuzzle.Decode(strings.NewReader(test.xml))
+		var derr *xmpuzzle.DecodeError
+		if !errors.Is(err, test.err) || !errors.As(err, &derr) || derr.Line != test.line {
+			t.Errorf("expected %v on line %v, got %v", test.err, test.line, err)
+		}
+	}
+	if _, err := xmpuzzle.Decode(strings.NewReader("<puzzle><shapes>")); err == nil {
+		t.Error("expected an error for truncated input")
+	}
+}
+
+func TestVoxelState(t *testing.T) {
+	v := xmpuzzle.Voxel{X: 3, Y: 1, Z: 1, Text: "#+12_"}
+	if v.GetVoxelState(0, 0, 0) != 1 || v.GetVoxelState(1, 0, 0) != 2 || v.GetVoxelColor(1, 0, 0) != 12 || v.GetVoxelState(2, 0, 0) != 0 {
+		t.Errorf("wrong states or colors for %q", v.Text)
+	}
+	// the states follow a change of the text
+	v.Text = "__#3"
+	if v.GetVoxelState(0, 0, 0) != 0 || v.GetVoxelState(2, 0, 0) != 1 || v.GetVoxelColor(2, 0, 0) != 3 {
+		t.Errorf("wrong states or colors for %q", v.Text)
+	}
+}
+
+func TestVoxelConcurrent(t *testing.T) {
+	// run with -race, the states of a voxel are parsed on first use
+	v := xmpuzzle.Voxel{X: 3, Y: 1, Z: 1, Text: "#+12_"}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v.GetVoxelColor(1, 0, 0) != 12 {
+				t.Errorf("wrong color for %q", v.Text)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestValidate(t *testing.T) {
+	files, _ := filepath.Glob("*.xmpuzzle")
+	for _, f := range files {
+		puzzle, err := xmpuzzle.LoadFile(f)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		if err := puzzle.Validate(); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+	}
+
+	puzzle := xmpuzzle.Puzzle{
+		Shapes: []xmpuzzle.Voxel{{X: 2, Y: 1, Z: 1, Text: "##"}, {X: 2, Y: 1, Z: 1, Text: "#"}, {X: 1, Y: 1, Z: 1, Text: "_"}},
+		Problems: []xmpuzzle.Problem{{
+			Shapes: []xmpuzzle.Shape{{Id: 3, Count: 1}, {Id: 0, Min: 2, Max: 1}, {Id: 2, Count: 1}, {Id: 0, Count: 40}},
+			Result: xmpuzzle.Result{Id: 5},
+		}},
+	}
+	err := puzzle.Validate()
+	var ve xmpuzzle.ValidationErrors
+	if !errors.As(err, &ve) || len(ve) != 5 {
+		t.Fatalf("expected 5 validation errors, got %v", err)
+	}
+	for _, target := range []error{xmpuzzle.ErrVoxelSize, xmpuzzle.ErrUnknownShape, xmpuzzle.ErrShapeCount, xmpuzzle.ErrEmptyShape} {
+		if !errors.Is(err, target) {
+			t.Errorf("expected %v in %v", target, err)
+		}
+	}
+}
+
+func TestMaxPieces(t *testing.T) {
+	puzzle := xmpuzzle.Puzzle{
+		Shapes:   []xmpuzzle.Voxel{{X: 1, Y: 1, Z: 1, Text: "#"}, {X: 1, Y: 1, Z: 1, Text: "#"}},
+		Problems: []xmpuzzle.Problem{{Result: xmpuzzle.Result{Id: 1}}},
+	}
+	pb := &puzzle.Problems[0]
+	for n := 0; n < xmpuzzle.MaxPieces; n += 250 {
+		pb.Shapes = append(pb.Shapes, xmpuzzle.Shape{Id: 0, Count: 250})
+	}
+	if err := puzzle.Validate(); err != nil {
+		t.Fatalf("expected %d pieces to be valid, got %v", xmpuzzle.MaxPieces, err)
+	}
+	pb.Shapes = append(pb.Shapes, xmpuzzle.Shape{Id: 0, Count: 1})
+	err := puzzle.Validate()
+	var ve xmpuzzle.ValidationErrors
+	if !errors.As(err, &ve) || len(ve) != 1 || !errors.Is(err, xmpuzzle.ErrTooManyPieces) {
+		t.Errorf("expected only %v, got %v", xmpuzzle.ErrTooManyPieces, err)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first solution BurrTools stored
+	s := &puzzle.Problems[0].Solutions[0]
+	if level, moves := s.Level(), s.Moves(); level != "2.1.2.1" || moves != 6 {
+		t.Errorf("expected level 2.1.2.1 and 6 moves, got %s %d", level, moves)
+	}
+	puzzle, err = xmpuzzle.LoadFile("two face 3.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = &puzzle.Problems[0].Solutions[0]
+	if level := s.Level(); !strings.Contains(level, "(") {
+		t.Errorf("expected a group of removed pieces in %s", level)
+	}
+}
+
+func TestMoveList(t *testing.T) {
+	puzzle, err := xmpuzzle.LoadFile("magic drawer.xmpuzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sep := puzzle.Problems[0].Solutions[0].Separation
+	moves, err := sep.MoveList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != sep.Moves() || !moves[len(moves)-1].Removed {
+		t.Errorf("expected %d moves, the last one a removal, got %+v", sep.Moves(), moves)
+	}
+	all, err := sep.AllMoves()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != sep.SumMoves() {
+		t.Errorf("expected %d moves for the disassembly, got %d", sep.SumMoves(), len(all))
+	}
+	// 2 slides of the same piece in the same direction are 1 move
+	split := xmpuzzle.Separation{Pieces: xmpuzzle.Pieces{Text: "0 1"}}
+	for _, x := range []string{"0 0", "0 1", "0 3", "0 20003"} {
+		split.State = append(split.State, xmpuzzle.State{DX: xmpuzzle.StatePositions{Text: x}, DY: xmpuzzle.StatePositions{Text: "0 0"}, DZ: xmpuzzle.StatePositions{Text: "0 0"}})
+	}
+	moves, err = split.MoveList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 2 || moves[0].Distance != 3 || moves[0].Direction != [3]int{1, 0, 0} || !moves[1].Removed {
+		t.Errorf("expected a slide of 3 and a removal, got %+v", moves)
+	}
+}
+
+func TestMirrorPartner(t *testing.T) {
+	// the left and right screw tetracubes are mirror images, the cube is its own mirror image
+	puzzle := &xmpuzzle.Puzzle{Shapes: []xmpuzzle.Voxel{
+		{X: 2, Y: 2, Z: 2, Text: "##_#___#"},
+		{X: 2, Y: 2, Z: 2, Text: "###___#_"},
+		{X: 1, Y: 1, Z: 1, Text: "#"},
+	}}
+	for idx, partner := range []int{1, 0, 2} {
+		if p := puzzle.Shapes[idx].MirrorPartner(puzzle); p != partner {
+			t.Errorf("shape %d: expected mirror partner %d, got %d", idx, partner, p)
+		}
+	}
+	if puzzle.Shapes[0].TransformsTo(&puzzle.Shapes[1], false) >= 0 {
+		t.Error("expected no rotation from the right to the left screw")
+	}
+}
+
+func TestWorldmap(t *testing.T) {
+	v := xmpuzzle.Voxel{X: 3, Y: 2, Z: 1, Text: "##_#_#"}
+	wm := v.NewWorldmap()
+	moved := wm.Clone()
+	moved.Translate(-5, 2, 7)
+	rotated := wm.Clone()
+	rotated.Rotate(5)
+	for key := 0; key < wm.Size(); key++ {
+		p := wm.Position(key)
+		if wm.Find(p) != key {
+			t.Errorf("entry %d not found at %v", key, p)
+		}
+		if q := moved.Position(key); q != [3]burrutils.Distance_t{p[0] - 5, p[1] + 2, p[2] + 7} || moved.Find(q) != key {
+			t.Errorf("entry %d not translated to %v", key, q)
+		}
+		rx, ry, rz := burrutils.Rotate(p[0], p[1], p[2], 5)
+		if rotated.Find([3]burrutils.Distance_t{rx, ry, rz}) != key {
+			t.Errorf("entry %d not rotated", key)
+		}
+	}
+	if wm.Has([3]burrutils.Distance_t{2, 0, 0}) || wm.Has([3]burrutils.Distance_t{-1, 0, 0}) || wm.Has([3]burrutils.Distance_t{0, 3, 0}) {
+		t.Error("found an empty position")
+	}
+	if bb := moved.CalcBoundingbox(); bb.Min != [3]burrutils.Distance_t{-5, 2, 7} || bb.Max != [3]burrutils.Distance_t{-3, 3, 7} {
+		t.Errorf("wrong boundingbox after translate: %v", bb)
+	}
+}
+
+func TestWorldmapTopology(t *testing.T) {
+	hollow := xmpuzzle.Voxel{X: 3, Y: 3, Z: 3, Text: strings.Repeat("#", 13) + "_" + strings.Repeat("#", 13)}
+	center := xmpuzzle.Voxel{X: 3, Y: 3, Z: 3, Text: strings.Repeat("_", 13) + "+" + strings.Repeat("_", 13)}
+	wm, cm := hollow.NewWorldmap(), center.NewWorldmap()
+	if c := wm.Components(); len(c) != 1 || len(c[0]) != 26 {
+		t.Errorf("expected 1 component of 26, got %v", c)
+	}
+	if c := wm.Cavities(); len(c) != 1 || len(c[0]) != 1 || c[0][0] != [3]burrutils.Distance_t{1, 1, 1} {
+		t.Errorf("expected the center as cavity, got %v", c)
+	}
+	if a := wm.SurfaceArea(); a != 60 {
+		t.Errorf("expected a surface area of 60, got %v", a)
+	}
+	full := wm.Union(cm)
+	if full.Size() != 27 || len(full.Cavities()) != 0 || full.Value(full.Find([3]burrutils.Distance_t{1, 1, 1})) != 2 {
+		t.Error("union does not fill the cavity with a variable voxel")
+	}
+	inner, outer := full.Intersection(wm), full.Difference(wm)
+	if inner.Size() != 26 || !outer.Equal(cm) {
+		t.Error("wrong intersection or difference")
+	}
+	moved := wm.Clone()
+	moved.Translate(4, -2, 1)
+	if !moved.EqualTranslated(wm) || moved.Equal(wm) || moved.EqualTranslated(full) {
+		t.Error("wrong translated equality")
+	}
+	a, b := moved.Canonical(), wm.Canonical()
+	for key := 0; key < a.Size(); key++ {
+		if a.Position(key) != b.Position(key) {
+			t.Fatalf("canonical forms differ at entry %d", key)
+		}
+	}
+	apart := xmpuzzle.Voxel{X: 3, Y: 1, Z: 1, Text: "#_#"}
+	am := apart.NewWorldmap()
+	if c := am.Components(); len(c) != 2 {
+		t.Errorf("expected 2 components, got %v", c)
+	}
+}
+
+func TestDuplicateShapes(t *testing.T) {
+	puzzle := &xmpuzzle.Puzzle{
+		Shapes: []xmpuzzle.Voxel{
+			{X: 2, Y: 2, Z: 2, Text: "##_#___#"},
+			{X: 2, Y: 2, Z: 2, Text: "###___#_"},
+			{X: 2, Y: 2, Z: 1, Text: "##_#"},
+			{X: 2, Y: 2, Z: 1, Text: "#_##"},
+			{X: 1, Y: 2, Z: 2, Text: "##_#"},
+		},
+		Problems: []xmpuzzle.Problem{{
+			Shapes: []xmpuzzle.Shape{{Id: 2, Count: 1}, {Id: 0, Count: 1}, {Id: 3, Count: 2}, {Id: 4, Min: 0, Max: 1}},
+		}},
+	}
+	expected := []xmpuzzle.ShapeDuplicate{{Shape: 1, Of: 0, Mirror: true}, {Shape: 3, Of: 2}, {Shape: 4, Of: 2}}
+	if d := puzzle.DuplicateShapes(); !reflect.DeepEqual(d, expected) {
+		t.Errorf("expected duplicates %v, got %v", expected, d)
+	}
+	if puzzle.Shapes[2].CanonicalKey() == puzzle.Shapes[0].CanonicalKey() || puzzle.Shapes[0].MirrorKey() != puzzle.Shapes[1].CanonicalKey() {
+		t.Error("wrong canonical keys")
+	}
+	removed, err := puzzle.MergeDuplicateShapes(0)
+	if err != nil || removed != 2 {
+		t.Fatalf("expected 2 merged shapes, got %v %v", removed, err)
+	}
+	merged := []xmpuzzle.Shape{{Id: 2, Min: 3, Max: 4}, {Id: 0, Count: 1}}
+	if !reflect.DeepEqual(puzzle.Problems[0].Shapes, merged) {
+		t.Errorf("expected shapes %v, got %v", merged, puzzle.Problems[0].Shapes)
+	}
+}
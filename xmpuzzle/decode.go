@@ -0,0 +1,283 @@
+package xmpuzzle
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrNoPuzzle     = errors.New("no puzzle element found")
+	ErrVoxelSize    = errors.New("voxel text does not match its dimensions")
+	ErrUnknownShape = errors.New("shape id does not refer to a voxel")
+)
+
+/*
+DecodeError is returned by Decode when the input is not a valid puzzle.
+Line and Element tell where in the input the problem was found.
+Use errors.Is to check for ErrNoPuzzle, ErrVoxelSize, ErrUnknownColor or ErrUnknownShape.
+*/
+type DecodeError struct {
+	Line    int
+	Element string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Element == "" {
+		return fmt.Sprintf("xmpuzzle: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("xmpuzzle: line %d: <%s>: %v", e.Line, e.Element, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// shapeRef remembers where a reference to a voxel was found, so it can be checked at the end
+type shapeRef struct {
+	line    int
+	element string
+	id      int
+}
+
+type decoder_t struct {
+	d    *xml.Decoder
+	refs []shapeRef
+}
+
+/*
+Decode reads a puzzle from r. The input can be gzip compressed (an xmpuzzle file) or plain XML.
+The voxel texts and the shape references of the problems are checked while reading.
+Elements that the package does not know are kept in the Unknown fields of the puzzle and its problems,
+only unknown elements in the lists of shapes and problems are skipped.
+*/
+func Decode(r io.Reader) (*Puzzle, error) {
+	br := bufio.NewReader(r)
+	var in io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		in = zr
+	}
+	dec := decoder_t{d: xml.NewDecoder(in)}
+	return dec.decode()
+}
+
+func (dec *decoder_t) line() int {
+	line, _ := dec.d.InputPos()
+	return line
+}
+
+func (dec *decoder_t) wrap(element string, err error) error {
+	var derr *DecodeError
+	if errors.As(err, &derr) {
+		return err
+	}
+	var serr *xml.SyntaxError
+	if errors.As(err, &serr) {
+		return &DecodeError{serr.Line, element, err}
+	}
+	return &DecodeError{dec.line(), element, err}
+}
+
+func (dec *decoder_t) decode() (*Puzzle, error) {
+	for {
+		tok, err := dec.d.Token()
+		if err == io.EOF {
+			return nil, &DecodeError{dec.line(), "", ErrNoPuzzle}
+		}
+		if err != nil {
+			return nil, dec.wrap("", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			if start.Name.Local != "puzzle" {
+				return nil, &DecodeError{dec.line(), start.Name.Local, ErrNoPuzzle}
+			}
+			p, err := dec.decodePuzzle(start)
+			if err != nil {
+				return nil, err
+			}
+			if err = dec.checkRefs(p); err != nil {
+				return nil, err
+			}
+			return p, nil
+		}
+	}
+}
+
+func (dec *decoder_t) decodePuzzle(start xml.StartElement) (*Puzzle, error) {
+	p := new(Puzzle)
+	if err := decodeAttributes(p, start); err != nil {
+		return nil, dec.wrap(start.Name.Local, err)
+	}
+	return p, dec.children(start.Name.Local, func(child xml.StartElement) error {
+		switch child.Name.Local {
+		case "gridType":
+			return dec.d.DecodeElement(&p.GridType, &child)
+		case "colors":
+			var colors struct {
+				Colors []Color `xml:"color"`
+			}
+			err := dec.d.DecodeElement(&colors, &child)
+			p.Colors = colors.Colors
+			return err
+		case "shapes":
+			return dec.children(child.Name.Local, func(v xml.StartElement) error {
+				if v.Name.Local != "voxel" {
+					return dec.d.Skip()
+				}
+				line := dec.line()
+				var voxel Voxel
+				if err := dec.d.DecodeElement(&voxel, &v); err != nil {
+					return err
+				}
+				if err := voxel.checkText(); err != nil {
+					return &DecodeError{line, v.Name.Local, fmt.Errorf("voxel %d (%q): %w", len(p.Shapes), voxel.Name, err)}
+				}
+				// parse the text now, so the solver does not wait for it
+				voxel.parse()
+				p.Shapes = append(p.Shapes, voxel)
+				return nil
+			})
+		case "problems":
+			return dec.children(child.Name.Local, func(pb xml.StartElement) error {
+				if pb.Name.Local != "problem" {
+					return dec.d.Skip()
+				}
+				problem, err := dec.decodeProblem(pb)
+				if err != nil {
+					return err
+				}
+				p.Problems = append(p.Problems, *problem)
+				return nil
+			})
+		case "comment":
+			return dec.d.DecodeElement(&p.Comment, &child)
+		default:
+			return dec.unknown(&p.Unknown, child)
+		}
+	})
+}
+
+func (dec *decoder_t) decodeProblem(start xml.StartElement) (*Problem, error) {
+	pb := new(Problem)
+	if err := decodeAttributes(pb, start); err != nil {
+		return nil, dec.wrap(start.Name.Local, err)
+	}
+	return pb, dec.children(start.Name.Local, func(child xml.StartElement) error {
+		switch child.Name.Local {
+		case "shapes":
+			return dec.children(child.Name.Local, func(s xml.StartElement) error {
+				if s.Name.Local != "shape" {
+					return dec.d.Skip()
+				}
+				line := dec.line()
+				var shape Shape
+				if err := dec.d.DecodeElement(&shape, &s); err != nil {
+					return err
+				}
+				dec.refs = append(dec.refs, shapeRef{line, s.Name.Local, int(shape.Id)})
+				pb.Shapes = append(pb.Shapes, shape)
+				return nil
+			})
+		case "result":
+			line := dec.line()
+			if err := dec.d.DecodeElement(&pb.Result, &child); err != nil {
+				return err
+			}
+			dec.refs = append(dec.refs, shapeRef{line, child.Name.Local, pb.Result.Id})
+			return nil
+		case "bitmap":
+			var bitmap struct {
+				Pairs []Pair `xml:"pair"`
+			}
+			err := dec.d.DecodeElement(&bitmap, &child)
+			pb.Bitmap = bitmap.Pairs
+			return err
+		case "solutions":
+			var solutions struct {
+				Solutions []Solution `xml:"solution"`
+			}
+			err := dec.d.DecodeElement(&solutions, &child)
+			pb.Solutions = solutions.Solutions
+			return err
+		case "comment":
+			return dec.d.DecodeElement(&pb.Comment, &child)
+		default:
+			return dec.unknown(&pb.Unknown, child)
+		}
+	})
+}
+
+/*
+unknown keeps an element that is not part of the format as far as this package knows it
+*/
+func (dec *decoder_t) unknown(list *[]Unknown, start xml.StartElement) error {
+	var u Unknown
+	if err := dec.d.DecodeElement(&u, &start); err != nil {
+		return err
+	}
+	*list = append(*list, u)
+	return nil
+}
+
+/*
+children calls f for every child element of the element that was just opened,
+and consumes the closing tag. Errors are annotated with the line number.
+*/
+func (dec *decoder_t) children(element string, f func(xml.StartElement) error) error {
+	for {
+		tok, err := dec.d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return dec.wrap(element, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if err := f(t); err != nil {
+				return dec.wrap(t.Name.Local, err)
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func (dec *decoder_t) checkRefs(p *Puzzle) error {
+	for _, ref := range dec.refs {
+		if ref.id < 0 || ref.id >= len(p.Shapes) {
+			return &DecodeError{ref.line, ref.element, fmt.Errorf("id %d: %w", ref.id, ErrUnknownShape)}
+		}
+	}
+	return nil
+}
+
+// tokenList_t replays a fixed list of tokens, see decodeAttributes
+type tokenList_t []xml.Token
+
+func (tl *tokenList_t) Token() (xml.Token, error) {
+	if len(*tl) == 0 {
+		return nil, io.EOF
+	}
+	tok := (*tl)[0]
+	*tl = (*tl)[1:]
+	return tok, nil
+}
+
+/*
+decodeAttributes fills the attribute fields of v from start, without touching the children.
+It lets the decoder walk the children itself and keep track of line numbers.
+*/
+func decodeAttributes(v any, start xml.StartElement) error {
+	tokens := tokenList_t{start, start.End()}
+	return xml.NewTokenDecoder(&tokens).Decode(v)
+}
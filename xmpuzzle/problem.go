@@ -13,10 +13,13 @@ type Problem struct {
 	Assemblies    int        `xml:"assemblies,attr"`
 	SolutionCount int        `xml:"solutions,attr"`
 	Time          int        `xml:"time,attr"`
+	MaxHoles      *int       `xml:"maxHoles,attr,omitempty"`
 	Shapes        []Shape    `xml:"shapes>shape"`
 	Result        Result     `xml:"result"`
+	Bitmap        []Pair     `xml:"bitmap>pair"`
 	Solutions     []Solution `xml:"solutions>solution"`
 	Comment       Comment    `xml:"comment"`
+	Unknown       []Unknown  `xml:",any"` // the elements that are not read into the fields above
 }
 
 func (p *Problem) NumShapes() int {
@@ -54,12 +57,49 @@ func (p *Problem) GetPartMaximum(partid burrutils.Id_t) (max uint8) {
 	return max
 }
 
-// KG: not implemented yet, returns false
+/*
+MaxHolesDefined returns true if the problem limits the number of
+variable voxels of the result that can stay empty
+*/
 func (p *Problem) MaxHolesDefined() bool {
-	return false
+	return p.MaxHoles != nil
 }
 
-// KG: not implemented yet, returns 0
+/*
+GetMaxHoles returns the maximum number of empty variable voxels, or 0 if there is no limit.
+Check MaxHolesDefined first.
+*/
 func (p *Problem) GetMaxHoles() int {
-	return 0
+	if p.MaxHoles == nil {
+		return 0
+	}
+	return *p.MaxHoles
+}
+
+/*
+SetMaxHoles limits the number of empty variable voxels. A negative value removes the limit.
+*/
+func (p *Problem) SetMaxHoles(holes int) {
+	if holes < 0 {
+		p.MaxHoles = nil
+		return
+	}
+	p.MaxHoles = &holes
+}
+
+/*
+PlacementAllowed returns true if a piece voxel with color pieceColor can be placed on a result voxel with color resultColor.
+Neutral voxels (color 0) fit everywhere, other colors need a pair in the bitmap of the problem.
+The pairs count the colors from 0, voxel colors from 1.
+*/
+func (p *Problem) PlacementAllowed(pieceColor, resultColor uint8) bool {
+	if pieceColor == 0 || resultColor == 0 {
+		return true
+	}
+	for _, pair := range p.Bitmap {
+		if pair.Piece+1 == int(pieceColor) && pair.Result+1 == int(resultColor) {
+			return true
+		}
+	}
+	return false
 }
@@ -9,8 +9,11 @@ type Puzzle struct {
 	XMLName  xml.Name  `xml:"puzzle"`
 	Version  string    `xml:"version,attr"`
 	GridType GridType  `xml:"gridType"`
+	Colors   []Color   `xml:"colors>color"`
 	Shapes   []Voxel   `xml:"shapes>voxel"`
 	Problems []Problem `xml:"problems>problem"`
+	Comment  Comment   `xml:"comment"`
+	Unknown  []Unknown `xml:",any"` // the elements that are not read into the fields above
 }
 
 func (p Puzzle) String() string {
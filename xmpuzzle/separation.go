@@ -0,0 +1,239 @@
+package xmpuzzle
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Moves returns the number of moves of the separation itself, the last one removes a group of pieces.
+The moves of the sub separations are not included.
+*/
+func (s *Separation) Moves() int {
+	if len(s.State) == 0 {
+		return 0
+	}
+	return len(s.State) - 1
+}
+
+/*
+SumMoves returns the total number of moves to take the puzzle apart completely
+*/
+func (s *Separation) SumMoves() int {
+	if s == nil {
+		return 0
+	}
+	sum := s.Moves()
+	for i := range s.Separations {
+		sum += s.Separations[i].SumMoves()
+	}
+	return sum
+}
+
+/*
+Levels returns the moves of every separation in the tree, the separation itself first
+and then its sub separations in the order they are stored (removed before left).
+*/
+func (s *Separation) Levels() []int {
+	if s == nil {
+		return nil
+	}
+	levels := []int{s.Moves()}
+	for i := range s.Separations {
+		levels = append(levels, s.Separations[i].Levels()...)
+	}
+	return levels
+}
+
+/*
+Level returns the level notation of the separation, like 5.3.2.1
+The moves of the pieces that are removed as a group are shown between brackets, like 5.(2.1).3.1
+*/
+func (s *Separation) Level() string {
+	if s == nil {
+		return ""
+	}
+	str := []string{strconv.Itoa(s.Moves())}
+	for i := range s.Separations {
+		if s.Separations[i].Type == "removed" {
+			str = append(str, "("+s.Separations[i].Level()+")")
+		} else {
+			str = append(str, s.Separations[i].Level())
+		}
+	}
+	return strings.Join(str, ".")
+}
+
+/*
+CompareLevel compares the levels of 2 separations. The result is negative if a has a lower level than b,
+positive if it is higher and 0 if they are the same. The moves of the separations are compared
+in the order of Levels, then the total number of moves.
+*/
+func CompareLevel(a, b *Separation) int {
+	la, lb := a.Levels(), b.Levels()
+	for i := 0; i < len(la) && i < len(lb); i++ {
+		if la[i] != lb[i] {
+			return la[i] - lb[i]
+		}
+	}
+	return a.SumMoves() - b.SumMoves()
+}
+
+/*
+Level returns the level notation of the disassembly of the solution, see Separation.Level
+*/
+func (s *Solution) Level() string {
+	return s.Separation.Level()
+}
+
+/*
+Moves returns the total number of moves of the disassembly of the solution
+*/
+func (s *Solution) Moves() int {
+	return s.Separation.SumMoves()
+}
+
+/*
+Move is one move of a disassembly: a group of pieces slides along one axis, or is taken out of the puzzle.
+*/
+type Move struct {
+	Pieces    []int  // the numbers of the pieces in the problem
+	Direction [3]int // unit vector of the axis, like {0, -1, 0}
+	Distance  int    // number of units, 0 when the pieces are removed
+	Removed   bool
+}
+
+// RemovedDistance is the smallest displacement that counts as taking the pieces out of the puzzle
+const RemovedDistance = 10000
+
+/*
+MoveList returns the moves between the states of the separation itself, the last one removes a group of pieces.
+Consecutive moves of the same pieces in the same direction are merged into one move, like BurrTools counts them.
+*/
+func (s *Separation) MoveList() ([]Move, error) {
+	pieces, err := parseInts(strings.Fields(s.Pieces.Text))
+	if err != nil {
+		return nil, err
+	}
+	var moves []Move
+	var prev [3][]int
+	for si := range s.State {
+		cur, err := s.State[si].Positions()
+		if err != nil {
+			return nil, err
+		}
+		if len(cur[0]) != len(pieces) {
+			return nil, fmt.Errorf("xmpuzzle: state %d has %d positions for %d pieces", si, len(cur[0]), len(pieces))
+		}
+		if si > 0 {
+			move, err := newMove(pieces, prev, cur)
+			if err != nil {
+				return nil, fmt.Errorf("xmpuzzle: state %d: %w", si, err)
+			}
+			if n := len(moves); n > 0 && !move.Removed && !moves[n-1].Removed &&
+				moves[n-1].Direction == move.Direction && slices.Equal(moves[n-1].Pieces, move.Pieces) {
+				moves[n-1].Distance += move.Distance
+			} else {
+				moves = append(moves, move)
+			}
+		}
+		prev = cur
+	}
+	return moves, nil
+}
+
+/*
+AllMoves returns the moves of the complete disassembly: the moves of the separation itself,
+followed by the moves of the sub separations in the order they are stored.
+*/
+func (s *Separation) AllMoves() ([]Move, error) {
+	if s == nil {
+		return nil, nil
+	}
+	moves, err := s.MoveList()
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.Separations {
+		sub, err := s.Separations[i].AllMoves()
+		if err != nil {
+			return nil, err
+		}
+		moves = append(moves, sub...)
+	}
+	return moves, nil
+}
+
+/*
+newMove returns the move between 2 states, all the pieces that move need to move the same way along 1 axis
+*/
+func newMove(pieces []int, from, to [3][]int) (Move, error) {
+	var move Move
+	var delta [3]int
+	for i := range pieces {
+		d := [3]int{to[0][i] - from[0][i], to[1][i] - from[1][i], to[2][i] - from[2][i]}
+		if d == [3]int{} {
+			continue
+		}
+		if len(move.Pieces) > 0 && d != delta {
+			return move, errors.New("pieces move in different directions")
+		}
+		delta = d
+		move.Pieces = append(move.Pieces, pieces[i])
+	}
+	if len(move.Pieces) == 0 {
+		return move, errors.New("no piece moves")
+	}
+	axes := 0
+	for dim, d := range delta {
+		if d == 0 {
+			continue
+		}
+		axes++
+		if d > 0 {
+			move.Direction[dim] = 1
+		} else {
+			move.Direction[dim] = -1
+			d = -d
+		}
+		if d >= RemovedDistance {
+			move.Removed = true
+		} else {
+			move.Distance = d
+		}
+	}
+	if axes != 1 {
+		return move, errors.New("pieces move along more than 1 axis")
+	}
+	return move, nil
+}
+
+/*
+Positions returns the x, y and z positions of the pieces in the state
+*/
+func (s *State) Positions() (pos [3][]int, err error) {
+	for dim, text := range [3]string{s.DX.Text, s.DY.Text, s.DZ.Text} {
+		if pos[dim], err = parseInts(strings.Fields(text)); err != nil {
+			return pos, err
+		}
+	}
+	if len(pos[1]) != len(pos[0]) || len(pos[2]) != len(pos[0]) {
+		return pos, errors.New("xmpuzzle: state has a different number of x, y and z positions")
+	}
+	return pos, nil
+}
+
+func parseInts(fields []string) ([]int, error) {
+	res := make([]int, len(fields))
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
@@ -0,0 +1,97 @@
+package xmpuzzle
+
+import (
+	"fmt"
+
+	burrutils "github.com/kgeusens/go/burr-data/burrutils"
+)
+
+/*
+ShapeDuplicate reports a shape of the puzzle that is the same as an earlier shape, or its mirror image
+*/
+type ShapeDuplicate struct {
+	Shape  int  // the index in Puzzle.Shapes
+	Of     int  // the index of the first shape it duplicates
+	Mirror bool // Shape is a mirror image of Of, not a rotation
+}
+
+/*
+DuplicateShapes lists the shapes that are a rotation or a mirror image of an earlier shape, apart from a translation.
+A shape that is both is reported as a rotation.
+*/
+func (p *Puzzle) DuplicateShapes() (duplicates []ShapeDuplicate) {
+	keys := make([]string, len(p.Shapes))
+	mirrors := make([]string, len(p.Shapes))
+	for i := range p.Shapes {
+		keys[i] = p.Shapes[i].CanonicalKey()
+		mirrors[i] = p.Shapes[i].MirrorKey()
+	}
+next:
+	for i := range p.Shapes {
+		for j := 0; j < i; j++ {
+			if keys[j] == keys[i] {
+				duplicates = append(duplicates, ShapeDuplicate{Shape: i, Of: j})
+				continue next
+			}
+		}
+		for j := 0; j < i; j++ {
+			if mirrors[j] == keys[i] {
+				duplicates = append(duplicates, ShapeDuplicate{Shape: i, Of: j, Mirror: true})
+				continue next
+			}
+		}
+	}
+	return
+}
+
+/*
+MergeDuplicateShapes merges the shapes of a problem that are a rotation of each other into the first one,
+with the sum of their counts, so the assembler handles them as copies of one piece.
+Only shapes of the same group are merged. The stored solutions of the problem are removed,
+because the merge changes the numbers of the pieces. The result is the number of shapes that were merged away.
+*/
+func (p *Puzzle) MergeDuplicateShapes(problem int) (int, error) {
+	pb := &p.Problems[problem]
+	keys := make(map[burrutils.Id_t]string)
+	for _, shape := range pb.Shapes {
+		if _, ok := keys[shape.Id]; !ok {
+			keys[shape.Id] = p.Shapes[shape.Id].CanonicalKey()
+		}
+	}
+	var merged []Shape
+	var minimum, maximum []int
+	for _, shape := range pb.Shapes {
+		idx := len(merged)
+		for i := range merged {
+			if merged[i].Group == shape.Group && keys[merged[i].Id] == keys[shape.Id] {
+				idx = i
+				break
+			}
+		}
+		if idx == len(merged) {
+			merged = append(merged, Shape{Id: shape.Id, Group: shape.Group})
+			minimum = append(minimum, 0)
+			maximum = append(maximum, 0)
+		}
+		minimum[idx] += int(shape.GetPartMinimum())
+		maximum[idx] += int(shape.GetPartMaximum())
+		if maximum[idx] > 255 {
+			return 0, fmt.Errorf("xmpuzzle: problem %d: shape %d: %w: more than 255 copies", problem, shape.Id, ErrShapeCount)
+		}
+	}
+	removed := len(pb.Shapes) - len(merged)
+	if removed == 0 {
+		return 0, nil
+	}
+	for i := range merged {
+		if minimum[i] == maximum[i] {
+			merged[i].Count = uint8(minimum[i])
+		} else {
+			merged[i].Min, merged[i].Max = uint8(minimum[i]), uint8(maximum[i])
+		}
+	}
+	pb.Shapes = merged
+	pb.Solutions = nil
+	pb.Assemblies, pb.SolutionCount, pb.Time, pb.State = 0, 0, 0, 0
+	return removed, nil
+}
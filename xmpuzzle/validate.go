@@ -0,0 +1,122 @@
+package xmpuzzle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+MaxPieces is the largest number of pieces a problem can have.
+The solver hashes the movement of 2 pieces in 64 bits, a problem with many large pieces
+can still be too large for it, see solver.ErrTooLarge.
+*/
+const MaxPieces = 10000
+
+var (
+	ErrShapeCount    = errors.New("count, min and max are inconsistent")
+	ErrEmptyShape    = errors.New("shape has no filled or variable voxels")
+	ErrNoPieces      = errors.New("problem has no pieces")
+	ErrTooManyPieces = fmt.Errorf("problem has more than %d pieces", MaxPieces)
+	ErrUnknownColor  = errors.New("color does not exist")
+)
+
+/*
+ValidationError describes a single structural problem in a puzzle.
+Problem is the index of the problem it was found in, or -1 if it is about the puzzle itself.
+*/
+type ValidationError struct {
+	Problem int
+	Element string
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Problem < 0 {
+		return fmt.Sprintf("%s: %v", e.Element, e.Err)
+	}
+	return fmt.Sprintf("problem %d: %s: %v", e.Problem, e.Element, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+/*
+ValidationErrors is the list of problems returned by Validate.
+errors.Is and errors.As look into every entry.
+*/
+type ValidationErrors []*ValidationError
+
+func (ve ValidationErrors) Error() string {
+	str := make([]string, len(ve))
+	for i, e := range ve {
+		str[i] = e.Error()
+	}
+	return strings.Join(str, "\n")
+}
+
+func (ve ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(ve))
+	for i, e := range ve {
+		errs[i] = e
+	}
+	return errs
+}
+
+/*
+Validate checks a loaded puzzle for structural problems that would make the solver fail.
+It does not stop at the first problem, the result is nil or a ValidationErrors with every problem found.
+*/
+func (p *Puzzle) Validate() error {
+	var ve ValidationErrors
+	report := func(problem int, element string, err error) {
+		ve = append(ve, &ValidationError{problem, element, err})
+	}
+	for idx := range p.Shapes {
+		if err := p.Shapes[idx].checkText(); err != nil {
+			report(-1, fmt.Sprintf("voxel %d (%q)", idx, p.Shapes[idx].Name), err)
+		}
+	}
+	// checkVoxel reports references to voxels that do not exist or can not be used
+	checkVoxel := func(pbidx int, element string, id int) {
+		if id < 0 || id >= len(p.Shapes) {
+			report(pbidx, element, fmt.Errorf("id %d: %w", id, ErrUnknownShape))
+		} else if p.Shapes[id].Size() == 0 {
+			report(pbidx, element, fmt.Errorf("voxel %d: %w", id, ErrEmptyShape))
+		}
+	}
+	for pbidx := range p.Problems {
+		pb := &p.Problems[pbidx]
+		checkVoxel(pbidx, "result", pb.Result.Id)
+		if len(pb.Shapes) == 0 {
+			report(pbidx, "shapes", ErrNoPieces)
+		}
+		numPieces := 0
+		for idx, shape := range pb.Shapes {
+			element := fmt.Sprintf("shape %d", idx)
+			checkVoxel(pbidx, element, int(shape.Id))
+			switch {
+			case shape.Count > 0 && (shape.Min != 0 || shape.Max != 0) && (shape.Min != shape.Count || shape.Max != shape.Count):
+				report(pbidx, element, fmt.Errorf("%w: count %d, min %d, max %d", ErrShapeCount, shape.Count, shape.Min, shape.Max))
+			case shape.Count == 0 && shape.Min > shape.Max:
+				report(pbidx, element, fmt.Errorf("%w: min %d is larger than max %d", ErrShapeCount, shape.Min, shape.Max))
+			case shape.Count == 0 && shape.Max == 0:
+				report(pbidx, element, fmt.Errorf("%w: no copies of the shape are used", ErrShapeCount))
+			}
+			numPieces += int(shape.GetPartMaximum())
+		}
+		if numPieces > MaxPieces {
+			report(pbidx, "shapes", fmt.Errorf("%w: %d", ErrTooManyPieces, numPieces))
+		}
+		for idx, pair := range pb.Bitmap {
+			if pair.Piece < 0 || pair.Piece >= len(p.Colors) || pair.Result < 0 || pair.Result >= len(p.Colors) {
+				report(pbidx, fmt.Sprintf("pair %d", idx), fmt.Errorf("%w: piece %d, result %d", ErrUnknownColor, pair.Piece, pair.Result))
+			}
+		}
+	}
+	if len(ve) == 0 {
+		return nil
+	}
+	return ve
+}
@@ -3,7 +3,8 @@ package xmpuzzle
 import (
 	"encoding/xml"
 	"fmt"
-	"regexp"
+	"math"
+	"sync"
 
 	burrutils "github.com/kgeusens/go/burr-data/burrutils"
 )
@@ -13,31 +14,110 @@ type Voxel struct {
 	X       burrutils.Distance_t `xml:"x,attr"`
 	Y       burrutils.Distance_t `xml:"y,attr"`
 	Z       burrutils.Distance_t `xml:"z,attr"`
-	Weight  uint                 `xml:"weight,attr"`
-	Name    string               `xml:"name,attr"`
+	Weight  uint                 `xml:"weight,attr,omitempty"`
+	Name    string               `xml:"name,attr,omitempty"`
 	Type    uint                 `xml:"type,attr"`
 	Text    string               `xml:",chardata"`
+	parsed  *voxelText_t         // the states and colors of Text, see parse
+}
+
+/*
+voxelText_t holds the state and the color of every position of a voxel, parsed from text
+*/
+type voxelText_t struct {
+	text   string
+	states []int8
+	colors []uint8
 }
 
 func (v Voxel) String() string {
 	return fmt.Sprintf("Piece Name:%v (X:%v Y:%v Z:%v) Value:%v", v.Name, v.X, v.Y, v.Z, v.Text)
 }
 
-func (v Voxel) GetVoxelState(x, y, z burrutils.Distance_t) (state int8) {
+/*
+checkText verifies that the text of the voxel describes exactly X*Y*Z positions.
+Digits are colors and belong to the position before them, a color can not be larger than 255.
+*/
+func (v *Voxel) checkText() error {
+	positions := 0
+	color := 0
+	for _, c := range v.Text {
+		if c < '0' || c > '9' {
+			positions++
+			color = 0
+		} else if color = color*10 + int(c-'0'); color > math.MaxUint8 {
+			return fmt.Errorf("%w: color %v at position %v", ErrUnknownColor, color, positions)
+		}
+	}
+	if positions != v.Volume() {
+		return fmt.Errorf("%w: %v positions for %vx%vx%v", ErrVoxelSize, positions, v.X, v.Y, v.Z)
+	}
+	return nil
+}
+
+/*
+parseText splits the text of the voxel in the state and the color of every position.
+A color is given by the digits after the state character, 0 is the neutral color.
+*/
+func (v Voxel) parseText() (states []int8, colors []uint8) {
+	states = make([]int8, 0, v.Volume())
+	colors = make([]uint8, 0, v.Volume())
+	for _, c := range v.Text {
+		switch {
+		case c >= '0' && c <= '9':
+			if len(colors) > 0 {
+				colors[len(colors)-1] = colors[len(colors)-1]*10 + uint8(c-'0')
+			}
+			continue
+		case c == '#':
+			states = append(states, 1)
+		case c == '+':
+			states = append(states, 2)
+		default:
+			states = append(states, 0)
+		}
+		colors = append(colors, 0)
+	}
+	return
+}
+
+// parseMutex guards the parsed field of every voxel, the solver reads the voxels of a puzzle from several goroutines
+var parseMutex sync.Mutex
+
+/*
+parse returns the states and colors of the voxel. They are parsed once, and again when Text changed.
+It is safe to call from several goroutines, as long as none of them changes Text.
+*/
+func (v *Voxel) parse() *voxelText_t {
+	parseMutex.Lock()
+	defer parseMutex.Unlock()
+	if v.parsed == nil || v.parsed.text != v.Text {
+		states, colors := v.parseText()
+		v.parsed = &voxelText_t{v.Text, states, colors}
+	}
+	return v.parsed
+}
+
+func (v Voxel) index(x, y, z burrutils.Distance_t) int {
+	return int(x) + int(y)*int(v.X) + int(z)*int(v.X)*int(v.Y)
+}
+
+func (v *Voxel) GetVoxelState(x, y, z burrutils.Distance_t) (state int8) {
 	if x >= v.X || y >= v.Y || z >= v.Z {
 		return 0
 	}
-	colorlessState := regexp.MustCompile(`/\d+/g`)
-	statePositions := colorlessState.ReplaceAllString(v.Text, "")
-	switch char := statePositions[x+y*v.X+z*v.X*v.Y]; char {
-	case '#':
-		state = 1
-	case '+':
-		state = 2
-	default:
-		state = 0
+	return v.parse().states[v.index(x, y, z)]
+}
+
+/*
+GetVoxelColor returns the color of a position, 0 is the neutral color.
+Colors refer to Puzzle.Colors, color n is Colors[n-1].
+*/
+func (v *Voxel) GetVoxelColor(x, y, z burrutils.Distance_t) (color uint8) {
+	if x >= v.X || y >= v.Y || z >= v.Z {
+		return 0
 	}
-	return
+	return v.parse().colors[v.index(x, y, z)]
 }
 
 /*
@@ -54,11 +134,8 @@ symgroupID int: number from 0 to 29 (the id of the symmetrygroup)
 func (v Voxel) CalcSelfSymmetries() (symgroupID int) {
 	rotSequence := [16]burrutils.Id_t{1, 4, 10, 2, 8, 16, 5, 7, 13, 15, 6, 9, 11, 14, 18, 22}
 	wm := v.NewWorldmap()
-	bb := wm.CalcBoundingbox()
-	bbX, bbY, bbZ := bb.Size()
 
 	symmetryMatrix := 1 // rotation 0
-	rbb := NewBoundingbox()
 	next := burrutils.Id_t(0)
 	rotidx := burrutils.Id_t(0)
 	rotlen := burrutils.Id_t(len(rotSequence))
@@ -66,43 +143,14 @@ func (v Voxel) CalcSelfSymmetries() (symgroupID int) {
 	for next < rotlen {
 		rotidx = rotSequence[next]
 		bit := 1 << rotidx
-		if (symmetryMatrix & bit) == 1 {
+		if (symmetryMatrix & bit) != 0 {
 			next++
 			continue
 		}
-		symmetric := true
-		// calculate new boundingbox and the offset between the boundingboxes
-		rotmin := [3]burrutils.Distance_t{}
-		rotmax := [3]burrutils.Distance_t{}
-		offset := [3]burrutils.Distance_t{0, 0, 0}
-		rotmin[0], rotmin[1], rotmin[2] = burrutils.Rotate(bb.Min[0], bb.Min[1], bb.Min[2], rotidx)
-		rotmax[0], rotmax[1], rotmax[2] = burrutils.Rotate(bb.Max[0], bb.Max[1], bb.Max[2], rotidx)
-		for i := 0; i < 3; i++ {
-			rbb.Min[i] = min(rotmin[i], rotmax[i])
-			rbb.Max[i] = max(rotmin[i], rotmax[i])
-			offset[i] = bb.Min[i] - rbb.Min[i]
-		}
-
-		// only continue if boxes have the same size
-		rbbX, rbbY, rbbZ := rbb.Size()
-		if rbbX != bbX || rbbY != bbY || rbbZ != bbZ {
-			symmetric = false
-			next++
-			continue
-		}
-		// now check rotations
-		wm := v.NewWorldmap()
-		for idx := range wm {
-			p := wm[idx].position
-			rX, rY, rZ := burrutils.Rotate(p[0], p[1], p[2], rotidx)
-			rX += offset[0]
-			rY += offset[1]
-			rZ += offset[2]
-			if !wm.Has([3]burrutils.Distance_t{rX, rY, rZ}) {
-				symmetric = false
-				break
-			}
-		}
+		// the rotated voxel has to be a translation of the voxel, colors included
+		rotated := wm.Clone()
+		rotated.Rotate(rotidx)
+		symmetric := rotated.EqualTranslated(wm)
 		// when we get here, symmetric determines symmetry in rotidx
 		if symmetric {
 			newSymmetrygroup := burrutils.RotationToSymmetrygroup[rotidx]
@@ -134,18 +182,82 @@ func (v Voxel) CalcSelfSymmetries() (symgroupID int) {
 
 func (v *Voxel) NewWorldmap() Worldmap {
 	wm := NewWorldmap()
+	parsed := v.parse()
+	states, colors := parsed.states, parsed.colors
 	for z := burrutils.Distance_t(0); z < v.Z; z++ {
 		for y := burrutils.Distance_t(0); y < v.Y; y++ {
 			for x := burrutils.Distance_t(0); x < v.X; x++ {
-				if s := v.GetVoxelState(x, y, z); s > 0 {
-					wm = append(wm, worldmapEntry{[3]burrutils.Distance_t{x, y, z}, s})
+				if idx := v.index(x, y, z); states[idx] > 0 {
+					wm.add([3]burrutils.Distance_t{x, y, z}, states[idx], colors[idx])
 				}
 			}
 		}
 	}
+	wm.reindex()
 	return wm
 }
 
+/*
+TransformsTo returns a transformation that turns v into other, apart from a translation.
+Set mirror to look for a mirror transformation, otherwise only rotations are checked.
+The result is -1 if there is none.
+*/
+func (v *Voxel) TransformsTo(other *Voxel, mirror bool) int {
+	target := other.NewWorldmap()
+	first := burrutils.Id_t(0)
+	if mirror {
+		first = burrutils.NumRotations
+	}
+	for t := first; t < first+burrutils.NumRotations; t++ {
+		wm := v.NewWorldmap()
+		wm.Transform(t)
+		if wm.EqualTranslated(target) {
+			return int(t)
+		}
+	}
+	return -1
+}
+
+/*
+CanonicalKey returns the smallest Worldmap Key of v over the 24 rotations.
+Two shapes have the same canonical key when one is a rotation of the other, apart from a translation.
+*/
+func (v *Voxel) CanonicalKey() string {
+	return v.canonicalKey(0)
+}
+
+/*
+MirrorKey returns the canonical key of the mirror image of v
+*/
+func (v *Voxel) MirrorKey() string {
+	return v.canonicalKey(burrutils.NumRotations)
+}
+
+func (v *Voxel) canonicalKey(first burrutils.Id_t) (key string) {
+	wm := v.NewWorldmap()
+	for t := first; t < first+burrutils.NumRotations; t++ {
+		twm := wm.Clone()
+		twm.Transform(t)
+		if k := twm.Key(); t == first || k < key {
+			key = k
+		}
+	}
+	return key
+}
+
+/*
+MirrorPartner returns the index of the first shape of the puzzle that is the mirror image of v,
+or -1 if there is none. A shape that is its own mirror image is its own partner.
+*/
+func (v *Voxel) MirrorPartner(p *Puzzle) int {
+	for idx := range p.Shapes {
+		if v.TransformsTo(&p.Shapes[idx], true) >= 0 {
+			return idx
+		}
+	}
+	return -1
+}
+
 func (v *Voxel) Size() (size int) {
 	size = 0
 	for _, c := range v.Text {
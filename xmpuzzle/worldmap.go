@@ -8,12 +8,13 @@ package xmpuzzle
 // You can rotate and translate a Worldmap
 // You can compare Worldmaps (needed to create the DLXmap)
 // You can clone a Worldmap
+// You can combine Worldmaps (union, intersection, difference) and inspect their topology
 // You can "instantiate" a Voxel into a Worldmap
 // I started with the idea that you need to use Worldmap to track State
 // but that is not the case. You need to track state on the Voxel, not the instance.
 
 import (
-	//	"slices"
+	"slices"
 
 	burrutils "github.com/kgeusens/go/burr-data/burrutils"
 )
@@ -23,10 +24,23 @@ import (
 type worldmapEntry struct {
 	position [3]burrutils.Distance_t
 	value    int8
+	color    uint8
 }
 
 // type Worldmap map[int]int
-type Worldmap []worldmapEntry
+
+/*
+Worldmap holds the entries in a slice, and a dense index over their boundingbox bb for constant time lookups:
+the entry at every position plus 1, or 0 if there is none. Clone copies the index along with the entries.
+Translate moves bb along with the entries, Rotate and Transform build a new index.
+The functions that return a Worldmap build its index, so Find only changes a worldmap that got entries outside
+its boundingbox since, and a worldmap can be read from several goroutines.
+*/
+type Worldmap struct {
+	entries []worldmapEntry
+	index   []int32
+	bb      Boundingbox
+}
 
 /*
 func HashToPoint(hash int) (x, y, z int) {
@@ -46,66 +60,175 @@ func PointToHash(x, y, z int) (hash int) {
 }
 */
 
-func (wm Worldmap) Value(idx int) int8 {
-	return wm[idx].value
+func (wm *Worldmap) Value(idx int) int8 {
+	return wm.entries[idx].value
 }
 
-func (wm Worldmap) Position(idx int) [3]burrutils.Distance_t {
-	return wm[idx].position
+func (wm *Worldmap) Position(idx int) [3]burrutils.Distance_t {
+	return wm.entries[idx].position
 }
 
-func (wm Worldmap) Has(p [3]burrutils.Distance_t) (ok bool) {
-	for key := range wm {
-		if wm[key].position == p {
-			return true
-		}
+func (wm *Worldmap) Color(idx int) uint8 {
+	return wm.entries[idx].color
+}
+
+func (wm *Worldmap) Has(p [3]burrutils.Distance_t) (ok bool) {
+	return wm.Find(p) >= 0
+}
+
+/*
+Find returns the index of the entry at position p, or -1 if there is none
+*/
+func (wm *Worldmap) Find(p [3]burrutils.Distance_t) int {
+	if len(wm.entries) == 0 {
+		return -1
+	}
+	if wm.index == nil {
+		// an entry outside the boundingbox was added since the last reindex
+		wm.reindex()
+	}
+	if !wm.inside(p) {
+		return -1
 	}
-	return false
+	return int(wm.index[wm.offset(p)]) - 1
 }
 
-func (wm Worldmap) Size() int {
-	return len(wm)
+/*
+inside returns true if position p is inside the boundingbox of the index
+*/
+func (wm *Worldmap) inside(p [3]burrutils.Distance_t) bool {
+	return p[0] >= wm.bb.Min[0] && p[1] >= wm.bb.Min[1] && p[2] >= wm.bb.Min[2] &&
+		p[0] <= wm.bb.Max[0] && p[1] <= wm.bb.Max[1] && p[2] <= wm.bb.Max[2]
 }
 
-func (wm Worldmap) Translate(x, y, z burrutils.Distance_t) {
-	for key := range wm {
-		wm[key].position[0] += x
-		wm[key].position[1] += y
-		wm[key].position[2] += z
+/*
+offset returns the index of position p, which has to be inside the boundingbox
+*/
+func (wm *Worldmap) offset(p [3]burrutils.Distance_t) int {
+	sx := int(wm.bb.Max[0]-wm.bb.Min[0]) + 1
+	sy := int(wm.bb.Max[1]-wm.bb.Min[1]) + 1
+	return int(p[0]-wm.bb.Min[0]) + sx*(int(p[1]-wm.bb.Min[1])+sy*int(p[2]-wm.bb.Min[2]))
+}
+
+/*
+reindex builds a new index for the entries
+*/
+func (wm *Worldmap) reindex() {
+	wm.index = nil
+	if len(wm.entries) == 0 {
+		return
+	}
+	wm.bb = wm.CalcBoundingbox()
+	size := 1
+	for dim := 0; dim < 3; dim++ {
+		size *= int(wm.bb.Max[dim]-wm.bb.Min[dim]) + 1
+	}
+	index := make([]int32, size)
+	for key := range wm.entries {
+		index[wm.offset(wm.entries[key].position)] = int32(key) + 1
 	}
+	wm.index = index
 }
 
-func (wm Worldmap) Rotate(rot burrutils.Id_t) {
-	for key := range wm {
-		rx, ry, rz := burrutils.Rotate(wm[key].position[0], wm[key].position[1], wm[key].position[2], rot)
-		wm[key].position[0] = rx
-		wm[key].position[1] = ry
-		wm[key].position[2] = rz
+/*
+add appends an entry. The index gets it when it is inside the boundingbox, otherwise the index is
+built again on the next Find, or with reindex after the last one.
+*/
+func (wm *Worldmap) add(p [3]burrutils.Distance_t, value int8, color uint8) {
+	wm.entries = append(wm.entries, worldmapEntry{p, value, color})
+	if wm.index != nil && wm.inside(p) {
+		wm.index[wm.offset(p)] = int32(len(wm.entries))
+		return
 	}
+	wm.index = nil
 }
 
-func (wm Worldmap) Clone() Worldmap {
-	twm := NewWorldmap()
-	for key := range wm {
-		twm = append(twm, worldmapEntry{[3]burrutils.Distance_t{wm[key].position[0], wm[key].position[1], wm[key].position[2]}, wm[key].value})
+func (wm *Worldmap) Size() int {
+	return len(wm.entries)
+}
+
+func (wm *Worldmap) Translate(x, y, z burrutils.Distance_t) {
+	for key := range wm.entries {
+		wm.entries[key].position[0] += x
+		wm.entries[key].position[1] += y
+		wm.entries[key].position[2] += z
 	}
+	d := [3]burrutils.Distance_t{x, y, z}
+	for dim := 0; dim < 3; dim++ {
+		wm.bb.Min[dim] += d[dim]
+		wm.bb.Max[dim] += d[dim]
+	}
+}
+
+func (wm *Worldmap) Rotate(rot burrutils.Id_t) {
+	for key := range wm.entries {
+		rx, ry, rz := burrutils.Rotate(wm.entries[key].position[0], wm.entries[key].position[1], wm.entries[key].position[2], rot)
+		wm.entries[key].position[0] = rx
+		wm.entries[key].position[1] = ry
+		wm.entries[key].position[2] = rz
+	}
+	wm.reindex()
+}
+
+/*
+Transform applies one of the 48 transformations of burrutils, rotations or their mirror images
+*/
+func (wm *Worldmap) Transform(t burrutils.Id_t) {
+	for key := range wm.entries {
+		rx, ry, rz := burrutils.Transform(wm.entries[key].position[0], wm.entries[key].position[1], wm.entries[key].position[2], t)
+		wm.entries[key].position[0] = rx
+		wm.entries[key].position[1] = ry
+		wm.entries[key].position[2] = rz
+	}
+	wm.reindex()
+}
+
+/*
+Normalize translates the worldmap so the minimum of its boundingbox is at the origin
+*/
+func (wm *Worldmap) Normalize() {
+	if len(wm.entries) == 0 {
+		return
+	}
+	bb := wm.CalcBoundingbox()
+	wm.Translate(-bb.Min[0], -bb.Min[1], -bb.Min[2])
+}
+
+/*
+Equal returns true if both worldmaps have the same positions, with the same values and colors
+*/
+func (wm *Worldmap) Equal(other Worldmap) bool {
+	if len(wm.entries) != len(other.entries) {
+		return false
+	}
+	return wm.equalShifted(other, [3]burrutils.Distance_t{})
+}
+
+func (wm *Worldmap) Clone() Worldmap {
+	twm := NewWorldmap()
+	twm.entries = append(make([]worldmapEntry, 0, len(wm.entries)), wm.entries...)
+	twm.index = slices.Clone(wm.index)
+	twm.bb = wm.bb
 	return twm
 }
 
-func (wm Worldmap) CalcBoundingbox() (bb Boundingbox) {
-	bb.Max[0] = wm[0].position[0]
-	bb.Max[1] = wm[0].position[1]
-	bb.Max[2] = wm[0].position[2]
-	bb.Min[0] = wm[0].position[0]
-	bb.Min[1] = wm[0].position[1]
-	bb.Min[2] = wm[0].position[2]
-	for idx := range wm {
-		bb.Min[0] = min(wm[idx].position[0], bb.Min[0])
-		bb.Min[1] = min(wm[idx].position[1], bb.Min[1])
-		bb.Min[2] = min(wm[idx].position[2], bb.Min[2])
-		bb.Max[0] = max(wm[idx].position[0], bb.Max[0])
-		bb.Max[1] = max(wm[idx].position[1], bb.Max[1])
-		bb.Max[2] = max(wm[idx].position[2], bb.Max[2])
+func (wm *Worldmap) CalcBoundingbox() (bb Boundingbox) {
+	if wm.index != nil {
+		return wm.bb
+	}
+	bb.Max[0] = wm.entries[0].position[0]
+	bb.Max[1] = wm.entries[0].position[1]
+	bb.Max[2] = wm.entries[0].position[2]
+	bb.Min[0] = wm.entries[0].position[0]
+	bb.Min[1] = wm.entries[0].position[1]
+	bb.Min[2] = wm.entries[0].position[2]
+	for idx := range wm.entries {
+		bb.Min[0] = min(wm.entries[idx].position[0], bb.Min[0])
+		bb.Min[1] = min(wm.entries[idx].position[1], bb.Min[1])
+		bb.Min[2] = min(wm.entries[idx].position[2], bb.Min[2])
+		bb.Max[0] = max(wm.entries[idx].position[0], bb.Max[0])
+		bb.Max[1] = max(wm.entries[idx].position[1], bb.Max[1])
+		bb.Max[2] = max(wm.entries[idx].position[2], bb.Max[2])
 	}
 	return
 }
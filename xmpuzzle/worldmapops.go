@@ -0,0 +1,243 @@
+package xmpuzzle
+
+import (
+	"cmp"
+	"slices"
+
+	burrutils "github.com/kgeusens/go/burr-data/burrutils"
+)
+
+// the 6 neighbours of a position that share a face with it
+var faceNeighbours = [6][3]burrutils.Distance_t{{-1, 0, 0}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0}, {0, 0, -1}, {0, 0, 1}}
+
+func neighbour(p [3]burrutils.Distance_t, d int) [3]burrutils.Distance_t {
+	return [3]burrutils.Distance_t{p[0] + faceNeighbours[d][0], p[1] + faceNeighbours[d][1], p[2] + faceNeighbours[d][2]}
+}
+
+/*
+Union returns the positions of both worldmaps. A position is filled if it is filled in one of them,
+otherwise it is variable. The color of wm is kept for the positions it has.
+*/
+func (wm *Worldmap) Union(other Worldmap) Worldmap {
+	res := wm.Clone()
+	for key := range other.entries {
+		e := other.entries[key]
+		if idx := wm.Find(e.position); idx < 0 {
+			res.add(e.position, e.value, e.color)
+		} else if e.value == 1 {
+			res.entries[idx].value = 1
+		}
+	}
+	res.reindex()
+	return res
+}
+
+/*
+Intersection returns the positions of wm that other has as well. A position is filled if it is filled in both,
+otherwise it is variable. The color of wm is kept.
+*/
+func (wm *Worldmap) Intersection(other Worldmap) Worldmap {
+	res := NewWorldmap()
+	for key := range wm.entries {
+		e := wm.entries[key]
+		if idx := other.Find(e.position); idx >= 0 {
+			if other.entries[idx].value != 1 {
+				e.value = 2
+			}
+			res.add(e.position, e.value, e.color)
+		}
+	}
+	res.reindex()
+	return res
+}
+
+/*
+Difference returns the positions of wm that other does not have, with their state and color
+*/
+func (wm *Worldmap) Difference(other Worldmap) Worldmap {
+	res := NewWorldmap()
+	for key := range wm.entries {
+		e := wm.entries[key]
+		if !other.Has(e.position) {
+			res.add(e.position, e.value, e.color)
+		}
+	}
+	res.reindex()
+	return res
+}
+
+/*
+EqualTranslated returns true if other is a translation of wm, with the same values and colors
+*/
+func (wm *Worldmap) EqualTranslated(other Worldmap) bool {
+	if len(wm.entries) != len(other.entries) {
+		return false
+	}
+	if len(wm.entries) == 0 {
+		return true
+	}
+	bb, obb := wm.CalcBoundingbox(), other.CalcBoundingbox()
+	var d [3]burrutils.Distance_t
+	for dim := 0; dim < 3; dim++ {
+		if bb.Max[dim]-bb.Min[dim] != obb.Max[dim]-obb.Min[dim] {
+			return false
+		}
+		d[dim] = obb.Min[dim] - bb.Min[dim]
+	}
+	return wm.equalShifted(other, d)
+}
+
+/*
+equalShifted returns true if other has every entry of wm, moved over d, with the same value and color.
+Both need to have the same size.
+*/
+func (wm *Worldmap) equalShifted(other Worldmap, d [3]burrutils.Distance_t) bool {
+	for key := range wm.entries {
+		p := wm.entries[key].position
+		idx := other.Find([3]burrutils.Distance_t{p[0] + d[0], p[1] + d[1], p[2] + d[2]})
+		if idx < 0 || other.entries[idx].value != wm.entries[key].value || other.entries[idx].color != wm.entries[key].color {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Canonical returns a normalized copy with the entries sorted on z, y and x.
+Worldmaps that are a translation of each other have identical canonical forms.
+*/
+func (wm *Worldmap) Canonical() Worldmap {
+	res := wm.Clone()
+	res.Normalize()
+	slices.SortFunc(res.entries, func(a, b worldmapEntry) int {
+		if c := cmp.Compare(a.position[2], b.position[2]); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.position[1], b.position[1]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.position[0], b.position[0])
+	})
+	res.reindex()
+	return res
+}
+
+/*
+Components returns the 6-connected components, the entries that are connected by their faces.
+Every component lists its entries in increasing order, the components are ordered by their first entry.
+*/
+func (wm *Worldmap) Components() (components [][]int) {
+	seen := make([]bool, len(wm.entries))
+	for start := range wm.entries {
+		if seen[start] {
+			continue
+		}
+		seen[start] = true
+		component := []int{start}
+		for next := 0; next < len(component); next++ {
+			p := wm.entries[component[next]].position
+			for d := range faceNeighbours {
+				if idx := wm.Find(neighbour(p, d)); idx >= 0 && !seen[idx] {
+					seen[idx] = true
+					component = append(component, idx)
+				}
+			}
+		}
+		slices.Sort(component)
+		components = append(components, component)
+	}
+	return
+}
+
+/*
+Cavities returns the enclosed cavities: the 6-connected groups of empty positions
+that can not reach the outside of the boundingbox through other empty positions.
+*/
+func (wm *Worldmap) Cavities() (cavities [][][3]burrutils.Distance_t) {
+	if len(wm.entries) == 0 {
+		return nil
+	}
+	bb := wm.CalcBoundingbox()
+	// the boundingbox with a layer of empty positions around it, every empty position is visited once
+	var lo, hi [3]burrutils.Distance_t
+	for dim := 0; dim < 3; dim++ {
+		lo[dim], hi[dim] = bb.Min[dim]-1, bb.Max[dim]+1
+	}
+	sx, sy := int(hi[0]-lo[0])+1, int(hi[1]-lo[1])+1
+	visited := make([]bool, sx*sy*(int(hi[2]-lo[2])+1))
+	offset := func(p [3]burrutils.Distance_t) int {
+		return int(p[0]-lo[0]) + sx*(int(p[1]-lo[1])+sy*int(p[2]-lo[2]))
+	}
+	// fill returns the empty positions that are connected to start
+	fill := func(start [3]burrutils.Distance_t) [][3]burrutils.Distance_t {
+		visited[offset(start)] = true
+		group := [][3]burrutils.Distance_t{start}
+		for next := 0; next < len(group); next++ {
+			for d := range faceNeighbours {
+				q := neighbour(group[next], d)
+				if q[0] < lo[0] || q[1] < lo[1] || q[2] < lo[2] || q[0] > hi[0] || q[1] > hi[1] || q[2] > hi[2] {
+					continue
+				}
+				if !visited[offset(q)] && !wm.Has(q) {
+					visited[offset(q)] = true
+					group = append(group, q)
+				}
+			}
+		}
+		return group
+	}
+	fill(lo)
+	for z := bb.Min[2]; z <= bb.Max[2]; z++ {
+		for y := bb.Min[1]; y <= bb.Max[1]; y++ {
+			for x := bb.Min[0]; x <= bb.Max[0]; x++ {
+				p := [3]burrutils.Distance_t{x, y, z}
+				if !visited[offset(p)] && !wm.Has(p) {
+					cavities = append(cavities, fill(p))
+				}
+			}
+		}
+	}
+	return
+}
+
+/*
+SurfaceArea returns the number of faces of the entries that do not touch another entry,
+the faces around the cavities included.
+*/
+func (wm *Worldmap) SurfaceArea() (area int) {
+	for key := range wm.entries {
+		for d := range faceNeighbours {
+			if !wm.Has(neighbour(wm.entries[key].position, d)) {
+				area++
+			}
+		}
+	}
+	return
+}
+
+/*
+Key encodes the canonical form: the size of the boundingbox, then the position, value and color of every entry.
+Worldmaps have the same key when they are a translation of each other.
+*/
+func (wm *Worldmap) Key() string {
+	if len(wm.entries) == 0 {
+		return ""
+	}
+	c := wm.Canonical()
+	buf := make([]byte, 0, 6+8*len(c.entries))
+	put := func(d burrutils.Distance_t) {
+		buf = append(buf, byte(d), byte(uint16(d)>>8))
+	}
+	bbX, bbY, bbZ := c.bb.Size()
+	put(bbX)
+	put(bbY)
+	put(bbZ)
+	for key := range c.entries {
+		e := c.entries[key]
+		put(e.position[0])
+		put(e.position[1])
+		put(e.position[2])
+		buf = append(buf, byte(e.value), e.color)
+	}
+	return string(buf)
+}
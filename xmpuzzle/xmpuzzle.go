@@ -4,9 +4,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/xml"
-	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	burrutils "github.com/kgeusens/go/burr-data/burrutils"
@@ -16,13 +16,43 @@ type GridType struct {
 	Type int `xml:"type,attr"`
 }
 
+type Color struct {
+	XMLName xml.Name `xml:"color"`
+	Red     uint8    `xml:"red,attr"`
+	Green   uint8    `xml:"green,attr"`
+	Blue    uint8    `xml:"blue,attr"`
+}
+
 type Shape struct {
 	XMLName xml.Name       `xml:"shape"`
 	Id      burrutils.Id_t `xml:"id,attr"`
 	Count   uint8          `xml:"count,attr"`
 	Min     uint8          `xml:"min,attr"`
 	Max     uint8          `xml:"max,attr"`
-	Group   uint8          `xml:"group,attr"`
+	Group   uint8          `xml:"group,attr,omitempty"`
+}
+
+/*
+MarshalXML writes a shape the way BurrTools does: a fixed number of copies
+is written as count, a range as min and max.
+*/
+func (s Shape) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "shape"
+	start.Attr = []xml.Attr{{Name: xml.Name{Local: "id"}, Value: strconv.Itoa(int(s.Id))}}
+	if s.Count > 0 || (s.Min == 0 && s.Max == 0) {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "count"}, Value: strconv.Itoa(int(s.Count))})
+	} else {
+		start.Attr = append(start.Attr,
+			xml.Attr{Name: xml.Name{Local: "min"}, Value: strconv.Itoa(int(s.Min))},
+			xml.Attr{Name: xml.Name{Local: "max"}, Value: strconv.Itoa(int(s.Max))})
+	}
+	if s.Group > 0 {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "group"}, Value: strconv.Itoa(int(s.Group))})
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
 }
 
 func (s *Shape) GetPartMinimum() (r uint8) {
@@ -48,11 +78,55 @@ type Result struct {
 	Id      int      `xml:"id,attr"`
 }
 
+type Pair struct {
+	XMLName xml.Name `xml:"pair"`
+	Piece   int      `xml:"piece,attr"`
+	Result  int      `xml:"result,attr"`
+}
+
 type Solution struct {
-	XMLName    xml.Name   `xml:"solution"`
-	AsmNum     int        `xml:"asmNum,attr"`
-	Assembly   Assembly   `xml:"assembly"`
-	Separation Separation `xml:"separation"`
+	XMLName        xml.Name        `xml:"solution"`
+	AsmNum         int             `xml:"asmNum,attr"` // -1 when the file does not give the number of the assembly
+	SolNum         int             `xml:"solNum,attr,omitempty"`
+	Assembly       Assembly        `xml:"assembly"`
+	Separation     *Separation     `xml:"separation,omitempty"`
+	SeparationInfo *SeparationInfo `xml:"separationInfo,omitempty"`
+}
+
+// solutionXML_t is a Solution the way it is written in the file, where asmNum is optional
+type solutionXML_t struct {
+	AsmNum         *int            `xml:"asmNum,attr"`
+	SolNum         int             `xml:"solNum,attr,omitempty"`
+	Assembly       Assembly        `xml:"assembly"`
+	Separation     *Separation     `xml:"separation,omitempty"`
+	SeparationInfo *SeparationInfo `xml:"separationInfo,omitempty"`
+}
+
+/*
+UnmarshalXML sets AsmNum to -1 when the solution has no asmNum
+*/
+func (s *Solution) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var sx solutionXML_t
+	if err := d.DecodeElement(&sx, &start); err != nil {
+		return err
+	}
+	*s = Solution{start.Name, -1, sx.SolNum, sx.Assembly, sx.Separation, sx.SeparationInfo}
+	if sx.AsmNum != nil {
+		s.AsmNum = *sx.AsmNum
+	}
+	return nil
+}
+
+/*
+MarshalXML leaves out asmNum when AsmNum is negative, like BurrTools does
+*/
+func (s Solution) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "solution"
+	sx := solutionXML_t{nil, s.SolNum, s.Assembly, s.Separation, s.SeparationInfo}
+	if s.AsmNum >= 0 {
+		sx.AsmNum = &s.AsmNum
+	}
+	return e.EncodeElement(sx, start)
 }
 
 type Assembly struct {
@@ -64,10 +138,19 @@ type Separation struct {
 	XMLName     xml.Name
 	Pieces      Pieces       `xml:"pieces"`
 	State       []State      `xml:"state"`
-	Type        string       `xml:"type,attr"`
+	Type        string       `xml:"type,attr,omitempty"`
 	Separations []Separation `xml:"separation"`
 }
 
+/*
+SeparationInfo is the compact form BurrTools uses when it does not store the full
+separation tree of a solution.
+*/
+type SeparationInfo struct {
+	XMLName xml.Name `xml:"separationInfo"`
+	Text    string   `xml:",chardata"`
+}
+
 type Pieces struct {
 	XMLName xml.Name `xml:"pieces"`
 	Count   int      `xml:"count,attr"`
@@ -101,27 +184,59 @@ type Comment struct {
 	Text    string   `xml:",chardata"`
 }
 
+/*
+Unknown holds an element of the file that this package does not know, with its attributes and its content
+as they were read, so it is written back unchanged
+*/
+type Unknown struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
+}
+
+/*
+MarshalXML omits empty comments, unless the comment was present when the puzzle was read
+*/
+func (c Comment) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if c.Text == "" && c.XMLName.Local == "" {
+		return nil
+	}
+	start.Name.Local = "comment"
+	return e.EncodeElement(struct {
+		Text string `xml:",chardata"`
+	}{c.Text}, start)
+}
+
+/*
+ParseXML parses a puzzle from an (uncompressed) XML string.
+It returns an empty Puzzle when the XML is not valid, use Decode to get the error.
+*/
 func ParseXML(xmlstring string) Puzzle {
-	xmldata := []byte(xmlstring)
-	var p Puzzle
-	xml.Unmarshal(xmldata, &p)
-	return p
+	p, err := Decode(strings.NewReader(xmlstring))
+	if err != nil {
+		return Puzzle{}
+	}
+	return *p
 }
 
+/*
+ReadFile returns the XML content of an xmpuzzle file.
+The file can be gzip compressed (as written by BurrTools) or plain XML.
+*/
 func ReadFile(filename string) (xml string, err error) {
 	f, err := os.ReadFile(filename)
 	if err != nil {
-		fmt.Println("error")
 		return
 	}
+	if len(f) < 2 || f[0] != 0x1f || f[1] != 0x8b {
+		return string(f), nil
+	}
 
-	b := bytes.NewBuffer(f)
-
-	var r io.Reader
-	r, err = gzip.NewReader(b)
+	r, err := gzip.NewReader(bytes.NewReader(f))
 	if err != nil {
 		return
 	}
+	defer r.Close()
 
 	var resB bytes.Buffer
 	_, err = resB.ReadFrom(r)
@@ -130,7 +245,68 @@ func ReadFile(filename string) (xml string, err error) {
 	}
 
 	xml = resB.String()
-
-	//	fmt.Println(xml)
 	return
 }
+
+/*
+LoadFile reads and decodes an xmpuzzle file
+*/
+func LoadFile(filename string) (*Puzzle, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+/*
+ToXML marshals the puzzle into the (uncompressed) XML format of BurrTools
+*/
+func (p *Puzzle) ToXML() (string, error) {
+	var b bytes.Buffer
+	if err := p.writeXML(&b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (p *Puzzle) writeXML(w io.Writer) error {
+	if _, err := io.WriteString(w, "<?xml version=\"1.0\"?>\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+/*
+Encode writes the puzzle as gzip compressed XML, the format of an xmpuzzle file
+*/
+func Encode(w io.Writer, p *Puzzle) error {
+	zw := gzip.NewWriter(w)
+	if err := p.writeXML(zw); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+/*
+WriteFile saves the puzzle as an xmpuzzle file that can be opened by BurrTools
+*/
+func WriteFile(filename string, p *Puzzle) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = Encode(f, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}